@@ -0,0 +1,119 @@
+package gemini
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrBodyTooLarge is returned when reading a response body that is larger
+	// than the max size. See Client.MaxBodySize.
+	ErrBodyTooLarge = errors.New("response body is too large")
+
+	// ErrIdleTimeout is returned when reading a response body fails because
+	// the server sent nothing for too long. See Client.IdleTimeout.
+	ErrIdleTimeout = errors.New("response body idle timeout")
+)
+
+// limitedBody is a response body that fails with ErrBodyTooLarge after n
+// bytes, if there are more to read.
+type limitedBody struct {
+	rc io.ReadCloser
+	n  int64 // Bytes left
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.n <= 0 {
+		// Check whether the body really is too large, or just ends here
+		var buf [1]byte
+		n, err := b.rc.Read(buf[:])
+		if n > 0 {
+			return 0, ErrBodyTooLarge
+		}
+		return 0, err
+	}
+	if int64(len(p)) > b.n {
+		p = p[:b.n]
+	}
+	n, err := b.rc.Read(p)
+	b.n -= int64(n)
+	return n, err
+}
+
+func (b *limitedBody) Close() error {
+	return b.rc.Close()
+}
+
+// ReadLimited reads from r until EOF, or until max bytes have been read. It
+// reports whether there was more to read, in which case the data is
+// truncated to max bytes. Reaching the MaxBodySize of a response body also
+// counts as truncation, not as an error.
+//
+// It's like io.ReadAll, but safe to use on a response body from an untrusted
+// server.
+func ReadLimited(r io.Reader, max int64) (data []byte, truncated bool, err error) {
+	data, err = io.ReadAll(io.LimitReader(r, max))
+	if err != nil {
+		if errors.Is(err, ErrBodyTooLarge) {
+			return data, true, nil
+		}
+		return data, false, err
+	}
+	if int64(len(data)) < max {
+		return data, false, nil
+	}
+	// Check for more data
+	var buf [1]byte
+	n, err := r.Read(buf[:])
+	if n > 0 || errors.Is(err, ErrBodyTooLarge) {
+		return data, true, nil
+	}
+	if err != nil && err != io.EOF {
+		return data, false, err
+	}
+	return data, false, nil
+}
+
+// idleBody is a response body that closes the connection if a read waits for
+// longer than the timeout.
+type idleBody struct {
+	rc      io.ReadCloser
+	conn    net.Conn
+	timeout time.Duration
+	timer   *time.Timer
+	expired atomic.Bool
+}
+
+func newIdleBody(rc io.ReadCloser, conn net.Conn, timeout time.Duration) *idleBody {
+	b := &idleBody{rc: rc, conn: conn, timeout: timeout}
+	b.timer = time.AfterFunc(timeout, func() {
+		b.expired.Store(true)
+		b.conn.Close()
+	})
+	// Only reads are timed
+	b.timer.Stop()
+	return b
+}
+
+func (b *idleBody) Read(p []byte) (int, error) {
+	b.timer.Reset(b.timeout)
+	n, err := b.rc.Read(p)
+	b.timer.Stop()
+	if err != nil && err != io.EOF && b.expired.Load() {
+		err = ErrIdleTimeout
+	}
+	return n, err
+}
+
+func (b *idleBody) Close() error {
+	b.timer.Stop()
+	err := b.rc.Close()
+	if b.expired.Load() {
+		// The connection was already closed
+		return nil
+	}
+	return err
+}
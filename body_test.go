@@ -0,0 +1,120 @@
+package gemini
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMaxBodySize(t *testing.T) {
+	body := strings.Repeat("a", 100)
+	addr := newTestServer(t, func(conn net.Conn) {
+		readRequest(conn)
+		conn.Write([]byte("20 text/plain\r\n" + body))
+	})
+
+	tests := []struct {
+		client, request int64
+		n               int
+		err             error
+	}{
+		{0, 0, 100, nil},
+		{100, 0, 100, nil},
+		{10, 0, 10, ErrBodyTooLarge},
+		{10, -1, 100, nil},
+		{0, 5, 5, ErrBodyTooLarge},
+	}
+	for _, tt := range tests {
+		req, _ := NewRequest("gemini://" + addr + "/")
+		req.MaxBodySize = tt.request
+		res, err := (&Client{MaxBodySize: tt.client}).Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		data, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if len(data) != tt.n || !errors.Is(err, tt.err) {
+			t.Errorf("limits %d and %d: expected %d bytes and error %v, got %d bytes and %v",
+				tt.client, tt.request, tt.n, tt.err, len(data), err)
+		}
+	}
+}
+
+func TestReadLimited(t *testing.T) {
+	tests := []struct {
+		body      string
+		max       int64
+		expected  string
+		truncated bool
+	}{
+		{"hello", 10, "hello", false},
+		{"hello", 5, "hello", false},
+		{"hello", 4, "hell", true},
+		{"", 0, "", false},
+	}
+	for _, tt := range tests {
+		data, truncated, err := ReadLimited(strings.NewReader(tt.body), tt.max)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.body, err)
+		}
+		if string(data) != tt.expected || truncated != tt.truncated {
+			t.Errorf("%q with max %d: expected %q and %v, got %q and %v",
+				tt.body, tt.max, tt.expected, tt.truncated, data, truncated)
+		}
+	}
+
+	// Hitting the limit of a limited body is truncation
+	lb := &limitedBody{rc: ioutil.NopCloser(strings.NewReader("hello")), n: 3}
+	data, truncated, err := ReadLimited(lb, 10)
+	if err != nil || string(data) != "hel" || !truncated {
+		t.Errorf("expected truncated %q, got %q, %v, %v", "hel", data, truncated, err)
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+	addr := newTestServer(t, func(conn net.Conn) {
+		readRequest(conn)
+		conn.Write([]byte("20 text/plain\r\n"))
+		// Keep sending, slower than the timeout overall but faster than it
+		// between writes
+		for i := 0; i < 5; i++ {
+			time.Sleep(20 * time.Millisecond)
+			conn.Write([]byte("a"))
+		}
+		<-done // Then go silent
+	})
+
+	client := &Client{IdleTimeout: 60 * time.Millisecond}
+	res, err := client.Fetch("gemini://" + addr + "/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	if !errors.Is(err, ErrIdleTimeout) {
+		t.Errorf("expected ErrIdleTimeout, got %v", err)
+	}
+	if string(data) != "aaaaa" {
+		t.Errorf("expected the stream before the timeout, got %q", data)
+	}
+
+	// Not reading doesn't count as idle
+	req, _ := NewRequest("gemini://" + addr + "/")
+	req.IdleTimeout = 60 * time.Millisecond
+	res, err = (&Client{}).Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer res.Body.Close()
+	time.Sleep(150 * time.Millisecond)
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(res.Body, buf); err != nil {
+		t.Errorf("unexpected error after not reading: %v", err)
+	}
+}
@@ -2,8 +2,10 @@ package gemini
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -11,7 +13,10 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"golang.org/x/net/idna"
 )
@@ -67,7 +72,31 @@ type Response struct {
 	Meta   string
 	Body   io.ReadCloser
 	Cert   *x509.Certificate
-	conn   net.Conn
+
+	// Redirects holds the URLs that were redirected from, in order, if the
+	// Client followed any redirects to get this response. It is empty
+	// otherwise. See Client.Redirects.
+	Redirects []string
+
+	// Request is the request that was sent to get this response. If redirects
+	// were followed, it is the last one.
+	Request *Request
+
+	// Resumed is true if the TLS session was resumed from an earlier
+	// connection, instead of making a full handshake. It's the same as
+	// TLS.DidResume. See Client.SessionCacheSize.
+	Resumed bool
+
+	// TLS holds the state of the TLS connection the response was received
+	// on, such as the negotiated version and cipher suite, and the full cert
+	// chain sent by the server.
+	TLS *tls.ConnectionState
+
+	// RemoteAddr is the network address that was connected to. When a proxy
+	// is used, it's the address of the proxy.
+	RemoteAddr string
+
+	conn net.Conn
 }
 
 type header struct {
@@ -76,6 +105,10 @@ type header struct {
 }
 
 // ProxyFunc. See Client documentation
+//
+// A ProxyFunc can't see the context of the request it connects for. If the
+// context is canceled first, the Client stops waiting for it, and closes the
+// connection it returns later.
 type ProxyFunc func(dialer *net.Dialer, address string) (net.Conn, error)
 
 type Client struct {
@@ -96,6 +129,23 @@ type Client struct {
 	// the spec.
 	AllowOutOfRangeStatuses bool
 
+	// MaxBodySize is the max number of bytes that can be read from a response
+	// body. Reading past it fails with ErrBodyTooLarge. If it's 0, there is no
+	// limit. It can be overridden for each request with Request.MaxBodySize.
+	//
+	// See ReadLimited for reading a body without getting an error.
+	MaxBodySize int64
+
+	// Strict makes the client reject response headers that don't follow the
+	// spec exactly: a two digit status, a single space, a UTF-8 meta string,
+	// and CRLF. The meta string of success responses must also be empty or a
+	// valid MIME type. Invalid headers cause a *HeaderError that wraps an
+	// error for the rule that was broken, such as ErrStatusDigits.
+	//
+	// By default the client is lenient, and accepts other whitespace after
+	// the status, for example.
+	Strict bool
+
 	// ConnectTimeout is equivalent to the Timeout field in net.Dialer.
 	// It's the max amount of time allowed for the initial connection/handshake.
 	// The timeout of the DefaultClient is 15 seconds.
@@ -112,6 +162,16 @@ type Client struct {
 	// can happen 30 seconds after the initial handshake.
 	ReadTimeout time.Duration
 
+	// IdleTimeout is the max amount of time a read of the response body can
+	// wait for data from the server. Unlike ReadTimeout, it is suitable for
+	// streams, because it only applies to each read on its own, so a stream
+	// stays open as long as the server keeps sending data. When it's exceeded,
+	// the connection is closed and ErrIdleTimeout is returned.
+	//
+	// It is independent of ReadTimeout and Response.SetReadTimeout, and is
+	// disabled if it's 0.
+	IdleTimeout time.Duration
+
 	// Proxy is a function that returns an existing connection. The TLS client
 	// will use this as the underlying transport, instead of making a direct TCP
 	// connection.
@@ -130,7 +190,112 @@ type Client struct {
 	//
 	//     func(dialer *net.Dialer, address string) (net.Conn, error)
 	//
+	// SOCKS5Proxy and HTTPConnectProxy return ProxyFuncs for common proxies.
 	Proxy ProxyFunc
+
+	// GeminiProxy, if set, is called for every request to get the Gemini proxy
+	// to send it to. This is the proxying built in to the Gemini protocol,
+	// which allows fetching URLs with other schemes, like gopher or https,
+	// through a Gemini server that supports it. See GeminiProxySchemes.
+	//
+	// It's not used for requests that already have a host set that differs
+	// from the URL's, like the ones made by FetchWithHost.
+	//
+	// When the proxy refuses the request or fails to get the resource, a
+	// *ProxyError is returned instead of the response.
+	GeminiProxy GeminiProxyFunc
+
+	// CertStore, if set, decides whether the server cert is trusted, after the
+	// hostname and expiry checks have passed. Setting it to a TOFUStore
+	// enables trust-on-first-use, as recommended by the Gemini spec.
+	//
+	// It is not used if Insecure is set.
+	CertStore CertStore
+
+	// Redirects, if set, makes the client follow redirects according to the
+	// policy, instead of returning redirect responses. See RedirectPolicy.
+	Redirects *RedirectPolicy
+
+	// Identities, if set, is used to find the client cert for requests that
+	// don't have one provided. See IdentityStore.
+	Identities *IdentityStore
+
+	// GetClientCertificate, if set, is called when the server asks for a
+	// client cert, for requests that don't have one provided or found in
+	// Identities. It is given the URL being requested. It can return nil to
+	// not send a cert.
+	//
+	// The returned cert's PrivateKey can be any crypto.Signer, so keys held in
+	// memory or behind an agent can be used without serializing them.
+	GetClientCertificate func(u *url.URL, info *tls.CertificateRequestInfo) (*tls.Certificate, error)
+
+	// InputFunc, if set, is called when a server asks for input, and the
+	// request is sent again with the input. See InputFunc.
+	InputFunc InputFunc
+
+	// MaxInputs is the max number of inputs InputFunc is asked for in a row
+	// for a single request. If the server still asks for input after that,
+	// ErrTooManyInputs is returned. If it's 0, DefaultMaxInputs is used.
+	MaxInputs int
+
+	// Retry, if set, makes the client retry requests that failed temporarily,
+	// according to the policy. See RetryPolicy.
+	Retry *RetryPolicy
+
+	// Transport, if set, is used to make every request, including the ones
+	// made to follow redirects. It allows intercepting requests for logging,
+	// caching, testing and so on. Transports that still want to make the
+	// request over the network can wrap the one returned by DefaultTransport.
+	Transport RoundTripper
+
+	// SessionCacheSize is the max number of TLS sessions the client keeps, so
+	// that later connections to the same host can resume them instead of
+	// making a full handshake. Sessions are only resumed for requests with the
+	// same client cert. If it's 0, DefaultSessionCacheSize is used. A negative
+	// value disables session resumption.
+	//
+	// When GetClientCertificate is set, sessions are never resumed for
+	// requests that don't have a cert from Request.Certificate or Identities,
+	// because the cert that would be sent isn't known before the handshake.
+	// If GetClientCertificate provides all the certs, that disables session
+	// resumption entirely.
+	//
+	// If TLSConfig has a ClientSessionCache, that is used instead. A copy of
+	// a Client starts with an empty cache of its own.
+	SessionCacheSize int
+
+	// TLSConfig, if set, is the TLS config used for connections. It is cloned
+	// for every request, and can be used to set the TLS versions, cipher
+	// suites, curve preferences and so on. If MinVersion is not set, TLS 1.2
+	// is used.
+	//
+	// InsecureSkipVerify is always set, because Gemini servers usually have
+	// self-signed certs, and the checks configured on the Client are made
+	// instead. If RootCAs is set, then the server cert must also be signed by
+	// one of those CAs, unless Insecure is set. VerifyPeerCertificate is still
+	// called, but with no verified chains.
+	//
+	// The client cert set on the request, or found in Identities, takes
+	// precedence over Certificates and GetClientCertificate.
+	TLSConfig *tls.Config
+
+	// KeyLogWriter, if set, is where TLS session keys are written in NSS key
+	// log format, so that connections can be decrypted for debugging. It
+	// takes precedence over the KeyLogWriter of TLSConfig, and over the
+	// SSLKEYLOGFILE environment variable.
+	//
+	// Logging keys breaks the security of the connections, so don't set it
+	// unless necessary.
+	KeyLogWriter io.Writer
+
+	// NoKeyLogFile stops the client from writing TLS session keys to the file
+	// named by the SSLKEYLOGFILE environment variable. The file is otherwise
+	// opened the first time any client connects, if the variable is set, and
+	// shared by all clients from then on. Changes to the variable after that
+	// are ignored.
+	NoKeyLogFile bool
+
+	sessions atomic.Value // *clientSessions
 }
 
 var DefaultClient = &Client{ConnectTimeout: 15 * time.Second}
@@ -155,24 +320,72 @@ func (r *Response) SetReadTimeout(d time.Duration) error {
 	return r.conn.SetDeadline(time.Now().Add(d))
 }
 
+// contextBody is the Response.Body for requests made with a context.
+// Reads fail with the context's error once it is canceled.
+type contextBody struct {
+	ctx  context.Context
+	rc   io.ReadCloser
+	stop func() bool // Stops the context.AfterFunc that closes the connection
+}
+
+func (b *contextBody) Read(p []byte) (int, error) {
+	n, err := b.rc.Read(p)
+	if err != nil && err != io.EOF {
+		err = contextError(b.ctx, err)
+	}
+	return n, err
+}
+
+func (b *contextBody) Close() error {
+	if !b.stop() {
+		// The connection was already closed due to the context
+		return nil
+	}
+	return b.rc.Close()
+}
+
+// contextError returns the context's error if it is done, otherwise err.
+// Connections are closed when a context is canceled, so this is used to
+// return a meaningful error instead of a network one.
+func contextError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
+
 // TODO: apply punycoding to hosts
 
 // Fetch a resource from a Gemini server with the given URL.
 // It assumes port 1965 if no port is specified.
 func (c *Client) Fetch(rawURL string) (*Response, error) {
-	parsedURL, err := url.Parse(rawURL)
+	return c.FetchContext(context.Background(), rawURL)
+}
+
+// FetchContext is like Fetch, but it uses the provided context for the
+// request. If the context is canceled or times out, connecting, sending the
+// request and reading the header will stop, and so will any reads of the
+// response body.
+func (c *Client) FetchContext(ctx context.Context, rawURL string) (*Response, error) {
+	req, err := NewRequestWithContext(ctx, rawURL)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse URL: %w", err)
+		return nil, err
 	}
-	return c.FetchWithHost(getHost(parsedURL), rawURL)
+	return c.Do(req)
 }
 
 // FetchWithHost fetches a resource from a Gemini server at the given host, with the given URL.
 // This can be used for Gemini proxying, where the URL host and actual server don't match.
 // It assumes the host is using port 1965 if no port number is provided.
 func (c *Client) FetchWithHost(host, rawURL string) (*Response, error) {
+	return c.FetchWithHostContext(context.Background(), host, rawURL)
+}
+
+// FetchWithHostContext is like FetchWithHost, but it uses the provided context
+// for the request. See FetchContext for details.
+func (c *Client) FetchWithHostContext(ctx context.Context, host, rawURL string) (*Response, error) {
 	// Call with empty PEM bytes to skip using a cert
-	return c.FetchWithHostAndCert(host, rawURL, []byte{}, []byte{})
+	return c.FetchWithHostAndCertContext(ctx, host, rawURL, []byte{}, []byte{})
 }
 
 // FetchWithCert fetches a resource from a Gemini server with the given URL.
@@ -182,29 +395,154 @@ func (c *Client) FetchWithHost(host, rawURL string) (*Response, error) {
 //
 // It assumes port 1965 if no port is specified.
 func (c *Client) FetchWithCert(rawURL string, certPEM, keyPEM []byte) (*Response, error) {
-	parsedURL, err := url.Parse(rawURL)
+	return c.FetchWithCertContext(context.Background(), rawURL, certPEM, keyPEM)
+}
+
+// FetchWithCertContext is like FetchWithCert, but it uses the provided context
+// for the request. See FetchContext for details.
+func (c *Client) FetchWithCertContext(ctx context.Context, rawURL string, certPEM, keyPEM []byte) (*Response, error) {
+	req, err := newCertRequest(ctx, rawURL, certPEM, keyPEM)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse URL: %w", err)
+		return nil, err
 	}
-	// Call with empty PEM bytes to skip using a cert
-	return c.FetchWithHostAndCert(getHost(parsedURL), rawURL, certPEM, keyPEM)
+	return c.Do(req)
+}
+
+// FetchWithTLSCert is like FetchWithCert, but it takes a prepared client
+// cert instead of PEM bytes. This avoids parsing the cert for every request,
+// and allows keys that can't be serialized, such as a crypto.Signer backed by
+// hardware or an agent, to be used as the PrivateKey.
+func (c *Client) FetchWithTLSCert(rawURL string, cert tls.Certificate) (*Response, error) {
+	return c.FetchWithTLSCertContext(context.Background(), rawURL, cert)
+}
+
+// FetchWithTLSCertContext is like FetchWithTLSCert, but it uses the provided
+// context for the request. See FetchContext for details.
+func (c *Client) FetchWithTLSCertContext(ctx context.Context, rawURL string, cert tls.Certificate) (*Response, error) {
+	req, err := NewRequestWithContext(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	req.Certificate = &cert
+	return c.Do(req)
 }
 
 // FetchWithHostAndCert combines FetchWithHost and FetchWithCert.
 func (c *Client) FetchWithHostAndCert(host, rawURL string, certPEM, keyPEM []byte) (*Response, error) {
-	u, err := GetPunycodeURL(rawURL)
+	return c.FetchWithHostAndCertContext(context.Background(), host, rawURL, certPEM, keyPEM)
+}
+
+// FetchWithHostAndCertContext is like FetchWithHostAndCert, but it uses the
+// provided context for the request. See FetchContext for details.
+func (c *Client) FetchWithHostAndCertContext(ctx context.Context, host, rawURL string, certPEM, keyPEM []byte) (*Response, error) {
+	req, err := newCertRequest(ctx, rawURL, certPEM, keyPEM)
 	if err != nil {
-		return nil, fmt.Errorf("error when punycoding URL: %w", err)
+		return nil, err
 	}
-	parsedURL, _ := url.Parse(u)
+	req.Host = host
+	return c.Do(req)
+}
 
-	if len(u) > URLMaxLength {
-		// Out of spec
-		return nil, fmt.Errorf("url is too long")
+// newCertRequest returns a request for the URL with the client cert parsed
+// from the PEM bytes. Empty bytes mean no cert.
+func newCertRequest(ctx context.Context, rawURL string, certPEM, keyPEM []byte) (*Request, error) {
+	req, err := NewRequestWithContext(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if len(certPEM) != 0 || len(keyPEM) != 0 {
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse cert/key PEM: %w", err)
+		}
+		req.Certificate = &cert
+	}
+	return req, nil
+}
+
+// Do sends the request and returns the response. All the Fetch methods use
+// it, and it can be used directly to set options for a single request.
+// See Request for details.
+func (c *Client) Do(req *Request) (*Response, error) {
+	if req.URL == nil {
+		return nil, ErrNoURL
+	}
+	res, err := c.sendFollowingRedirects(req)
+	if err == nil && c.InputFunc != nil && SimplifyStatus(res.Status) == StatusInput {
+		return c.handleInput(res)
+	}
+	return res, err
+}
+
+// sendFollowingRedirects sends the request, and follows redirects if the
+// client is set to.
+func (c *Client) sendFollowingRedirects(req *Request) (*Response, error) {
+	res, err := c.send(req)
+	if err == nil && c.Redirects != nil {
+		res, err = c.followRedirects(res, req)
+	}
+	return res, err
+}
+
+// send makes a single request using the client's transport, retrying it if
+// the client is set to.
+func (c *Client) send(req *Request) (*Response, error) {
+	roundTrip := c.fetch
+	if c.Transport != nil {
+		roundTrip = c.Transport.RoundTrip
+	}
+
+	var res *Response
+	var err error
+	if c.Retry != nil {
+		res, err = c.sendWithRetries(req, roundTrip)
+	} else {
+		res, err = roundTrip(req)
+	}
+	if res != nil && res.Request == nil {
+		res.Request = req
 	}
+	return res, err
+}
+
+// connectTimeout returns the connect timeout for the request.
+func (c *Client) connectTimeout(req *Request) time.Duration {
+	if req.ConnectTimeout != 0 {
+		return req.ConnectTimeout
+	}
+	return c.ConnectTimeout
+}
 
+// readTimeout returns the read timeout for the request.
+func (c *Client) readTimeout(req *Request) time.Duration {
+	if req.ReadTimeout != 0 {
+		return req.ReadTimeout
+	}
+	return c.ReadTimeout
+}
+
+// idleTimeout returns the idle timeout for the request.
+func (c *Client) idleTimeout(req *Request) time.Duration {
+	if req.IdleTimeout != 0 {
+		return req.IdleTimeout
+	}
+	return c.IdleTimeout
+}
+
+// maxBodySize returns the max body size for the request, or 0 if there is
+// no limit.
+func (c *Client) maxBodySize(req *Request) int64 {
+	if req.MaxBodySize != 0 {
+		return req.MaxBodySize
+	}
+	return c.MaxBodySize
+}
+
+// fullHost adds the default port to host if it doesn't have one, and
+// punycodes it.
+func fullHost(host string) (string, error) {
 	// Add port to host if needed
-	_, _, err = net.SplitHostPort(host)
+	_, _, err := net.SplitHostPort(host)
 	if err != nil {
 		// Error likely means there's no port in the host
 		host = net.JoinHostPort(host, "1965")
@@ -212,18 +550,48 @@ func (c *Client) FetchWithHostAndCert(host, rawURL string, certPEM, keyPEM []byt
 	ogHost := host
 	host, err = punycodeHost(host)
 	if err != nil {
-		return nil, fmt.Errorf("failed to punycode host %s: %w", ogHost, err)
+		return "", fmt.Errorf("failed to punycode host %s: %w", ogHost, err)
+	}
+	return host, nil
+}
+
+// fetch makes a single request, without following redirects.
+func (c *Client) fetch(req *Request) (*Response, error) {
+	ctx := req.Context()
+
+	u, err := GetPunycodeURL(req.URL.String())
+	if err != nil {
+		return nil, fmt.Errorf("error when punycoding URL: %w", err)
+	}
+	parsedURL, _ := url.Parse(u)
+
+	if len(u) > URLMaxLength {
+		// Out of spec
+		return nil, ErrURLTooLong
+	}
+
+	host := req.Host
+	if host == "" {
+		host = getHost(parsedURL)
+	}
+	host, err = fullHost(host)
+	if err != nil {
+		return nil, err
+	}
+	proxy, err := c.geminiProxy(parsedURL, host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Gemini proxy: %w", err)
+	}
+	if proxy != "" {
+		host = proxy
 	}
 
-	// Build tls.Certificate
 	var cert tls.Certificate
-	if len(certPEM) == 0 && len(keyPEM) == 0 {
-		// Cert bytes were intentionally left empty
-		cert = tls.Certificate{}
-	} else {
-		cert, err = tls.X509KeyPair(certPEM, keyPEM)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse cert/key PEM: %w", err)
+	if req.Certificate != nil {
+		cert = *req.Certificate
+	} else if c.Identities != nil {
+		if id, ok := c.Identities.Lookup(u); ok {
+			cert = id.TLSCertificate()
 		}
 	}
 
@@ -231,50 +599,81 @@ func (c *Client) FetchWithHostAndCert(host, rawURL string, certPEM, keyPEM []byt
 
 	// Connect
 
+	connectTimeout := c.connectTimeout(req)
+	readTimeout := c.readTimeout(req)
+
 	start := time.Now()
-	conn, err := c.connect(&res, host, parsedURL, cert)
+	conn, err := c.connect(ctx, &res, host, parsedURL, cert, connectTimeout, readTimeout)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to the server: %w", err)
+		return nil, fmt.Errorf("failed to connect to the server: %w", contextError(ctx, err))
 	}
 
+	trace := ContextClientTrace(ctx)
+
+	// From now on, canceling the context closes the connection, which
+	// unblocks any reads or writes in progress
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+
 	// Send request
 
-	if c.ReadTimeout == 0 && c.ConnectTimeout != 0 {
+	if readTimeout == 0 && connectTimeout != 0 {
 		// No r/w timeout, so a timeout for sending the request must be set
-		conn.SetDeadline(start.Add(c.ConnectTimeout))
+		conn.SetDeadline(start.Add(connectTimeout))
 	}
 	err = sendRequest(conn, u)
+	trace.wroteRequest(err)
 	if err != nil {
+		stop()
 		conn.Close()
-		return nil, err
+		return nil, contextError(ctx, err)
 	}
-	if c.ReadTimeout == 0 && c.ConnectTimeout != 0 {
+	if readTimeout == 0 && connectTimeout != 0 {
 		// Undo deadline
 		conn.SetDeadline(time.Time{})
 	}
 
 	// Get header
 
-	if c.ReadTimeout == 0 && c.ConnectTimeout != 0 {
+	if readTimeout == 0 && connectTimeout != 0 {
 		// No r/w timeout, so a timeout for getting the header
-		conn.SetDeadline(start.Add(c.ConnectTimeout))
+		conn.SetDeadline(start.Add(connectTimeout))
+	}
+	var rc io.ReadCloser = conn
+	if trace != nil && trace.GotFirstResponseByte != nil {
+		rc = &firstByteReader{ReadCloser: conn, trace: trace}
 	}
-	err = getResponse(&res, conn)
+	err = getResponse(&res, rc, c.Strict)
 	if err != nil {
+		stop()
 		conn.Close()
-		return nil, err
+		return nil, contextError(ctx, err)
 	}
-	if c.ReadTimeout == 0 && c.ConnectTimeout != 0 {
+	if readTimeout == 0 && connectTimeout != 0 {
 		// Undo deadline
 		conn.SetDeadline(time.Time{})
 	}
 
 	// Check status code
 	if !c.AllowOutOfRangeStatuses && !StatusInRange(res.Status) {
+		stop()
 		conn.Close()
-		return nil, fmt.Errorf("invalid status code: %v", res.Status)
+		return nil, Error{Err: ErrInvalidStatus, Status: res.Status}
+	}
+	if proxy != "" {
+		if err := proxyError(proxy, parsedURL, &res); err != nil {
+			stop()
+			conn.Close()
+			return nil, err
+		}
 	}
 
+	res.Body = &contextBody{ctx: ctx, rc: res.Body, stop: stop}
+	if idleTimeout := c.idleTimeout(req); idleTimeout > 0 {
+		res.Body = newIdleBody(res.Body, conn, idleTimeout)
+	}
+	if max := c.maxBodySize(req); max > 0 {
+		res.Body = &limitedBody{rc: res.Body, n: max}
+	}
 	return &res, nil
 }
 
@@ -284,6 +683,11 @@ func Fetch(url string) (*Response, error) {
 	return DefaultClient.Fetch(url)
 }
 
+// FetchContext is like Fetch, but it uses the provided context for the request.
+func FetchContext(ctx context.Context, url string) (*Response, error) {
+	return DefaultClient.FetchContext(ctx, url)
+}
+
 // FetchWithCert fetches a resource from a Gemini server with the given URL.
 // It allows you to provide the bytes of a PEM encoded block for a client
 // certificate and its key. This allows you to make requests using client
@@ -294,6 +698,12 @@ func FetchWithCert(url string, certPEM, keyPEM []byte) (*Response, error) {
 	return DefaultClient.FetchWithCert(url, certPEM, keyPEM)
 }
 
+// FetchWithCertContext is like FetchWithCert, but it uses the provided context
+// for the request.
+func FetchWithCertContext(ctx context.Context, url string, certPEM, keyPEM []byte) (*Response, error) {
+	return DefaultClient.FetchWithCertContext(ctx, url, certPEM, keyPEM)
+}
+
 // FetchWithHost fetches a resource from a Gemini server at the given host, with the given URL.
 // This can be used for proxying, where the URL host and actual server don't match.
 // It assumes the host is using port 1965 if no port number is provided.
@@ -301,64 +711,195 @@ func FetchWithHost(host, url string) (*Response, error) {
 	return DefaultClient.FetchWithHost(host, url)
 }
 
+// FetchWithHostContext is like FetchWithHost, but it uses the provided context
+// for the request.
+func FetchWithHostContext(ctx context.Context, host, url string) (*Response, error) {
+	return DefaultClient.FetchWithHostContext(ctx, host, url)
+}
+
+// FetchWithTLSCert is like FetchWithCert, but it takes a prepared client
+// cert instead of PEM bytes.
+func FetchWithTLSCert(url string, cert tls.Certificate) (*Response, error) {
+	return DefaultClient.FetchWithTLSCert(url, cert)
+}
+
+// FetchWithTLSCertContext is like FetchWithTLSCert, but it uses the provided
+// context for the request.
+func FetchWithTLSCertContext(ctx context.Context, url string, cert tls.Certificate) (*Response, error) {
+	return DefaultClient.FetchWithTLSCertContext(ctx, url, cert)
+}
+
 // FetchWithHostAndCert combines FetchWithHost and FetchWithCert.
 func FetchWithHostAndCert(host, url string, certPEM, keyPEM []byte) (*Response, error) {
 	return DefaultClient.FetchWithHostAndCert(host, url, certPEM, keyPEM)
 }
 
-func (c *Client) connect(res *Response, host string, parsedURL *url.URL, clientCert tls.Certificate) (net.Conn, error) {
-	conf := &tls.Config{
-		MinVersion:         tls.VersionTLS12,
-		InsecureSkipVerify: true, // This must be set to allow self-signed certs
+// FetchWithHostAndCertContext is like FetchWithHostAndCert, but it uses the
+// provided context for the request.
+func FetchWithHostAndCertContext(ctx context.Context, host, url string, certPEM, keyPEM []byte) (*Response, error) {
+	return DefaultClient.FetchWithHostAndCertContext(ctx, host, url, certPEM, keyPEM)
+}
+
+// tlsConfig returns a copy of the config to use for a connection, without
+// the client cert and session cache.
+func (c *Client) tlsConfig() *tls.Config {
+	var conf *tls.Config
+	if c.TLSConfig == nil {
+		conf = &tls.Config{}
+	} else {
+		conf = c.TLSConfig.Clone()
+	}
+	if conf.MinVersion == 0 {
+		conf.MinVersion = tls.VersionTLS12
+	}
+	// This must be set to allow self-signed certs, verifyCert does the checks
+	conf.InsecureSkipVerify = true
+	return conf
+}
+
+// keyLogWriter returns the writer TLS keys should be logged to, or nil if the
+// one from TLSConfig should be used.
+func (c *Client) keyLogWriter() io.Writer {
+	if c.KeyLogWriter != nil {
+		return c.KeyLogWriter
+	}
+	if c.NoKeyLogFile || (c.TLSConfig != nil && c.TLSConfig.KeyLogWriter != nil) {
+		return nil
+	}
+	return keyLogFile()
+}
+
+// keyLogFile returns the file named by the SSLKEYLOGFILE environment variable,
+// or nil if it isn't set. The file is opened the first time it's called, and
+// then shared by all clients, so it stays open.
+var keyLogFile = sync.OnceValue(openKeyLogFile)
+
+// Support logging TLS keys for debugging - See PR #5
+func openKeyLogFile() io.Writer {
+	keylogfile := os.Getenv("SSLKEYLOGFILE")
+	if keylogfile == "" {
+		return nil
 	}
+	w, err := os.OpenFile(keylogfile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil
+	}
+	return w
+}
+
+func (c *Client) connect(ctx context.Context, res *Response, host string, parsedURL *url.URL, clientCert tls.Certificate, connectTimeout, readTimeout time.Duration) (net.Conn, error) {
+	conf := c.tlsConfig()
+	conf.ClientSessionCache = c.sessionCache(host, clientCert, conf.ClientSessionCache)
 	if clientCert.Certificate != nil {
 		// There is data, not an empty struct
 		conf.Certificates = []tls.Certificate{clientCert}
+	} else if c.GetClientCertificate != nil {
+		conf.GetClientCertificate = func(info *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, err := c.GetClientCertificate(parsedURL, info)
+			if cert == nil && err == nil {
+				// No cert is sent when it's empty
+				cert = &tls.Certificate{}
+			}
+			return cert, err
+		}
 	}
 
-	// Support logging TLS keys for debugging - See PR #5
-	keylogfile := os.Getenv("SSLKEYLOGFILE")
-	if keylogfile != "" {
-		w, err := os.OpenFile(keylogfile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
-		if err == nil {
-			conf.KeyLogWriter = w
-			defer w.Close()
-		}
+	if w := c.keyLogWriter(); w != nil {
+		conf.KeyLogWriter = w
+	}
+
+	// The connect timeout covers both the dial and the handshake
+	if connectTimeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, connectTimeout)
+		defer cancel()
 	}
+	dialer := &net.Dialer{Timeout: connectTimeout}
+	trace := ContextClientTrace(ctx)
 
-	var conn *tls.Conn
+	var rawConn net.Conn
 	var err error
 	if c.Proxy == nil {
-		// Dialer timeout for handshake
-		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: c.ConnectTimeout}, "tcp", host, conf)
-		res.conn = conn
-		if err != nil {
-			return conn, err
-		}
+		rawConn, err = dialer.DialContext(trace.dialContext(ctx), "tcp", host)
 	} else {
 		// Use proxy
-		proxyConn, err := c.Proxy(&net.Dialer{Timeout: c.ConnectTimeout}, host)
-		if err != nil {
-			return nil, err
-		}
-		conn = tls.Client(proxyConn, conf)
-		// Make handshake manually to start connection, so later call to
-		// conn.ConnectionState() works
-		if err := conn.Handshake(); err != nil {
-			return nil, err
-		}
+		trace.proxyDialStart(host)
+		rawConn, err = c.dialProxy(ctx, dialer, host)
+		trace.proxyDialDone(host, err)
+	}
+	if err != nil {
+		return nil, err
 	}
+	if conf.ServerName == "" {
+		// Send SNI, like tls.Dial does
+		conf.ServerName, _, _ = net.SplitHostPort(host)
+	}
+	conn := tls.Client(rawConn, conf)
+	// Make handshake manually to start connection, so later call to
+	// conn.ConnectionState() works
+	trace.tlsHandshakeStart()
+	err = conn.HandshakeContext(ctx)
+	state := conn.ConnectionState()
+	trace.tlsHandshakeDone(state, err)
+	if err != nil {
+		rawConn.Close()
+		return nil, err
+	}
+	res.conn = conn
+	res.TLS = &state
+	res.Resumed = state.DidResume
+	res.RemoteAddr = rawConn.RemoteAddr().String()
 
-	if c.ReadTimeout != 0 {
-		conn.SetDeadline(time.Now().Add(c.ReadTimeout))
+	if readTimeout != 0 {
+		conn.SetDeadline(time.Now().Add(readTimeout))
 	}
 
-	cert := conn.ConnectionState().PeerCertificates[0]
+	cert := state.PeerCertificates[0]
 	res.Cert = cert
 
+	err = c.verifyCert(host, state.PeerCertificates)
+	trace.verifiedCert(host, cert, err)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// dialProxy connects to host using the Proxy function. ProxyFunc can't see
+// the context, so the dial continues in the background if the context is done
+// first, and the connection it makes is closed.
+func (c *Client) dialProxy(ctx context.Context, dialer *net.Dialer, host string) (net.Conn, error) {
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		conn, err := c.Proxy(dialer, host)
+		ch <- result{conn, err}
+	}()
+
+	select {
+	case r := <-ch:
+		return r.conn, r.err
+	case <-ctx.Done():
+		go func() {
+			if r := <-ch; r.conn != nil {
+				r.conn.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// verifyCert runs all the enabled checks on the server cert. host is the
+// host:port that was connected to.
+func (c *Client) verifyCert(host string, certs []*x509.Certificate) error {
 	if c.Insecure {
-		return conn, nil
+		return nil
 	}
+	cert := certs[0]
 
 	// Verify hostname
 	if !c.NoHostnameCheck {
@@ -370,24 +911,43 @@ func (c *Client) connect(res *Response, host string, parsedURL *url.URL, clientC
 			uniHost, uniErr := idna.ToUnicode(hostname)
 			err2 := verifyHostname(cert, uniHost)
 			if uniErr != nil {
-				return nil, fmt.Errorf("punycoded hostname does not verify and could not be converted to Unicode: %w", err)
+				return certError(cert, host, ErrHostnameMismatch, fmt.Errorf("punycoded hostname could not be converted to Unicode: %w", err))
 			}
 			if err2 != nil {
-				return nil, fmt.Errorf("hostname does not verify: %w", err2)
+				return certError(cert, host, ErrHostnameMismatch, err2)
 			}
-			return nil, fmt.Errorf("hostname does not verify: %w", err)
+			return certError(cert, host, ErrHostnameMismatch, err)
 		}
 	}
 	// Verify expiry
 	if !c.NoTimeCheck {
 		if cert.NotBefore.After(time.Now()) {
-			return nil, fmt.Errorf("server cert is for the future")
+			return certError(cert, host, ErrCertNotYetValid, nil)
 		} else if cert.NotAfter.Before(time.Now()) {
-			return nil, fmt.Errorf("server cert is expired")
+			return certError(cert, host, ErrCertExpired, nil)
+		}
+	}
+	// Verify the cert is signed by a CA, if there are any
+	if c.TLSConfig != nil && c.TLSConfig.RootCAs != nil {
+		opts := x509.VerifyOptions{
+			Roots:         c.TLSConfig.RootCAs,
+			Intermediates: x509.NewCertPool(),
+		}
+		for _, ic := range certs[1:] {
+			opts.Intermediates.AddCert(ic)
+		}
+		if _, err := cert.Verify(opts); err != nil {
+			return certError(cert, host, ErrUnknownAuthority, err)
+		}
+	}
+	// Verify the cert is trusted
+	if c.CertStore != nil {
+		if err := c.CertStore.Check(host, cert); err != nil {
+			return err
 		}
 	}
 
-	return conn, nil
+	return nil
 }
 
 func sendRequest(conn io.Writer, requestURL string) error {
@@ -398,8 +958,8 @@ func sendRequest(conn io.Writer, requestURL string) error {
 	return nil
 }
 
-func getResponse(res *Response, conn io.ReadCloser) error {
-	header, err := getHeader(conn)
+func getResponse(res *Response, conn io.ReadCloser, strict bool) error {
+	header, rest, err := getHeader(conn, strict)
 	if err != nil {
 		conn.Close()
 		return fmt.Errorf("failed to get header: %w", err)
@@ -407,24 +967,52 @@ func getResponse(res *Response, conn io.ReadCloser) error {
 
 	res.Status = header.status
 	res.Meta = header.meta
-	res.Body = conn
+	if len(rest) == 0 {
+		res.Body = conn
+	} else {
+		// Part of the body was read with the header
+		res.Body = &prefixedBody{Reader: io.MultiReader(bytes.NewReader(rest), conn), rc: conn}
+	}
 	return nil
 }
 
-func getHeader(conn io.Reader) (header, error) {
-	line, err := readHeader(conn)
+// prefixedBody is a response body that starts with bytes that were already
+// read from the connection.
+type prefixedBody struct {
+	io.Reader
+	rc io.ReadCloser
+}
+
+func (b *prefixedBody) Close() error {
+	return b.rc.Close()
+}
+
+// getHeader reads and parses the header. It also returns any bytes that were
+// read past the header, which are the start of the body. If strict is true,
+// the header must follow the spec exactly, see checkStrictHeader.
+func getHeader(conn io.Reader, strict bool) (header, []byte, error) {
+	line, rest, err := readHeader(conn, strict)
 	if err != nil {
-		return header{}, fmt.Errorf("failed to read header: %w", err)
+		var headerErr *HeaderError
+		if errors.As(err, &headerErr) {
+			return header{}, nil, err
+		}
+		return header{}, nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	if strict {
+		if err := checkStrictHeader(line); err != nil {
+			return header{}, nil, &HeaderError{Line: string(line), Err: err}
+		}
 	}
 
 	fields := strings.Fields(string(line))
 	if len(fields) == 0 || (len(fields) < 2 && line[len(line)-1] != ' ') {
-		return header{}, fmt.Errorf("header not formatted correctly")
+		return header{}, nil, &HeaderError{Line: string(line), Err: ErrMalformedHeader}
 	}
 
 	status, err := strconv.Atoi(fields[0])
 	if err != nil {
-		return header{}, fmt.Errorf("unexpected status value %v: %w", fields[0], err)
+		return header{}, nil, &HeaderError{Line: string(line), Err: fmt.Errorf("%w: unexpected status value %v", ErrInvalidStatus, fields[0])}
 	}
 
 	var meta string
@@ -434,29 +1022,84 @@ func getHeader(conn io.Reader) (header, error) {
 		meta = string(line)[len(fields[0])+1:]
 	}
 	if len(meta) > MetaMaxLength {
-		return header{}, fmt.Errorf("meta string is too long")
+		return header{}, nil, &HeaderError{Line: string(line), Err: ErrMetaTooLong}
 	}
 
-	return header{status, meta}, nil
+	return header{status, meta}, rest, nil
 }
 
-func readHeader(conn io.Reader) ([]byte, error) {
-	var line []byte
-	delim := []byte("\r\n")
-	// A small buffer is inefficient but the maximum length of the header is small so it's okay
-	buf := make([]byte, 1)
-
-	for {
-		n, err := conn.Read(buf)
-		if err == io.EOF && n <= 0 {
-			return []byte{}, err
-		} else if err != nil && err != io.EOF {
-			return []byte{}, err
+// checkStrictHeader returns an error if the header line, without the CRLF,
+// isn't exactly a two digit status, a space and a UTF-8 meta string. For
+// success statuses, the meta string must be empty or a valid MIME type.
+func checkStrictHeader(line []byte) error {
+	digits := 0
+	for digits < len(line) && line[digits] >= '0' && line[digits] <= '9' {
+		digits++
+	}
+	if digits != 2 {
+		return ErrStatusDigits
+	}
+	if len(line) == 2 || line[2] != ' ' {
+		return ErrHeaderSpace
+	}
+	meta := line[3:]
+	if len(meta) > 0 && (meta[0] == ' ' || meta[0] == '\t') {
+		return ErrHeaderSpace
+	}
+	if bytes.ContainsAny(meta, "\r\n") {
+		return ErrHeaderLineBreak
+	}
+	if !utf8.Valid(meta) {
+		return ErrMetaNotUTF8
+	}
+	if line[0] == '2' && len(meta) > 0 {
+		if _, err := ParseMediaType(string(meta)); err != nil {
+			return fmt.Errorf("%w: %w", ErrMetaMediaType, err)
 		}
+	}
+	return nil
+}
+
+// headerMaxLength is the max length of a header allowed by the spec: a two
+// digit status, a space, the meta string, and CRLF.
+const headerMaxLength = 2 + 1 + MetaMaxLength + 2
 
-		line = append(line, buf...)
-		if bytes.HasSuffix(line, delim) {
-			return line[:len(line)-len(delim)], nil
+// readHeader reads the header line, and returns it without the CRLF. The
+// reads are made in chunks, so bytes past the header may have been read, and
+// they're returned as rest.
+//
+// If there is no CRLF within headerMaxLength bytes, reading stops and a
+// *HeaderError wrapping ErrMetaTooLong is returned, so a server can't make
+// the client read an unlimited amount of data.
+//
+// If strict is true, a header ended by an LF without a CR is rejected with a
+// *HeaderError wrapping ErrHeaderLineBreak as soon as the LF is read.
+func readHeader(conn io.Reader, strict bool) (line, rest []byte, err error) {
+	buf := make([]byte, headerMaxLength)
+	n := 0
+	for n < len(buf) {
+		m, err := conn.Read(buf[n:])
+		// Start searching one byte back, in case the CR was at the end of the
+		// last read
+		start := n - 1
+		if start < 0 {
+			start = 0
+		}
+		n += m
+		if i := bytes.Index(buf[start:n], []byte("\r\n")); i != -1 {
+			i += start
+			return buf[:i], buf[i+2 : n], nil
+		}
+		if strict {
+			// Any LF so far isn't part of a CRLF
+			if i := bytes.IndexByte(buf[:n], '\n'); i != -1 {
+				return nil, nil, &HeaderError{Line: string(buf[:i]), Err: ErrHeaderLineBreak}
+			}
+		}
+		if err != nil {
+			return nil, nil, err
 		}
 	}
+	// The last byte may be the CR of a CRLF that was too late
+	return nil, nil, &HeaderError{Line: string(bytes.TrimSuffix(buf, []byte("\r"))), Err: ErrMetaTooLong}
 }
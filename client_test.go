@@ -1,12 +1,28 @@
 package gemini
 
 import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"math/big"
+	"net"
 	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"testing/iotest"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 )
@@ -41,7 +57,7 @@ func TestGetResponse(t *testing.T) {
 		file     string
 		expected Response
 	}{
-		{"resources/tests/simple_response", Response{20, "text/gemini", ioutil.NopCloser(strings.NewReader("This is the content of the page\r\n")), nil, nil}},
+		{"resources/tests/simple_response", Response{Status: 20, Meta: "text/gemini", Body: ioutil.NopCloser(strings.NewReader("This is the content of the page\r\n"))}},
 	}
 
 	for _, tc := range tests {
@@ -51,7 +67,7 @@ func TestGetResponse(t *testing.T) {
 		}
 
 		res := Response{}
-		err = getResponse(&res, f)
+		err = getResponse(&res, f, false)
 		if err != nil {
 			t.Fatalf("failed to parse response %s: %v", tc.file, err)
 		}
@@ -65,14 +81,14 @@ func TestGetResponse(t *testing.T) {
 }
 
 func TestGetResponseEmptyResponse(t *testing.T) {
-	err := getResponse(&Response{}, ioutil.NopCloser(strings.NewReader("")))
+	err := getResponse(&Response{}, ioutil.NopCloser(strings.NewReader("")), false)
 	if err == nil {
 		t.Fatalf("expected to get an error for empty response, got nil instead")
 	}
 }
 
 func TestGetResponseInvalidStatus(t *testing.T) {
-	err := getResponse(&Response{}, ioutil.NopCloser(strings.NewReader("AA\tmeta\r\n")))
+	err := getResponse(&Response{}, ioutil.NopCloser(strings.NewReader("AA\tmeta\r\n")), false)
 	if err == nil {
 		t.Fatalf("expected to get an error for invalid status response, got nil instead")
 	}
@@ -80,7 +96,7 @@ func TestGetResponseInvalidStatus(t *testing.T) {
 
 func TestGetHeaderLongMeta(t *testing.T) {
 	// Meta longer than allowed
-	_, err := getHeader(strings.NewReader("20 " + strings.Repeat("a", MetaMaxLength+1) + "\r\n"))
+	_, _, err := getHeader(strings.NewReader("20 "+strings.Repeat("a", MetaMaxLength+1)+"\r\n"), false)
 	if err == nil {
 		t.Fatalf(fmt.Sprintf("expected to get an error for meta longer than %d", MetaMaxLength))
 	}
@@ -88,33 +104,140 @@ func TestGetHeaderLongMeta(t *testing.T) {
 
 func TestGetHeaderOnlyLF(t *testing.T) {
 	// Meta longer than 1024 chars
-	_, err := getHeader(strings.NewReader("20 test" + "\n"))
+	_, _, err := getHeader(strings.NewReader("20 test"+"\n"), false)
 	if err == nil {
 		t.Fatalf("expected to get an error for header ending only in LF")
 	}
 }
 
 func TestGetHeaderNoSpace(t *testing.T) {
-	_, err := getHeader(strings.NewReader("20\r\n"))
+	_, _, err := getHeader(strings.NewReader("20\r\n"), false)
 	if err == nil {
 		t.Fatalf("expected to get an error for header with no space")
 	}
 }
 
 func TestGetHeaderOnlyRN(t *testing.T) {
-	_, err := getHeader(strings.NewReader("\r\n"))
+	_, _, err := getHeader(strings.NewReader("\r\n"), false)
 	if err == nil {
 		t.Fatalf("expected to get an error for only \\r\\n header")
 	}
 }
 
 func TestGetHeaderWhitespaceAndRN(t *testing.T) {
-	_, err := getHeader(strings.NewReader(" \r\n"))
+	_, _, err := getHeader(strings.NewReader(" \r\n"), false)
 	if err == nil {
 		t.Fatalf("expected to get an error for whitespace + \\r\\n header")
 	}
 }
 
+func TestReadHeaderChunks(t *testing.T) {
+	const header = "20 text/gemini"
+	const body = "# Hello\r\nWorld"
+	readers := map[string]func() io.Reader{
+		"one read":   func() io.Reader { return strings.NewReader(header + "\r\n" + body) },
+		"byte reads": func() io.Reader { return iotest.OneByteReader(strings.NewReader(header + "\r\n" + body)) },
+		"split CRLF": func() io.Reader {
+			return io.MultiReader(strings.NewReader(header+"\r"), strings.NewReader("\n"+body))
+		},
+	}
+	for name, r := range readers {
+		res := Response{}
+		if err := getResponse(&res, ioutil.NopCloser(r()), false); err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+			continue
+		}
+		if res.Status != 20 || res.Meta != "text/gemini" {
+			t.Errorf("%s: unexpected header: %d %q", name, res.Status, res.Meta)
+		}
+		got, _ := ioutil.ReadAll(res.Body)
+		if string(got) != body {
+			t.Errorf("%s: expected body %q, got %q", name, body, got)
+		}
+	}
+}
+
+// endlessReader returns an endless header with no CRLF, and counts the bytes
+// read from it.
+type endlessReader struct {
+	n int
+}
+
+func (r *endlessReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 'a'
+	}
+	r.n += len(p)
+	return len(p), nil
+}
+
+func TestReadHeaderLimit(t *testing.T) {
+	r := &endlessReader{}
+	_, _, err := getHeader(io.MultiReader(strings.NewReader("20 "), r), false)
+	if !errors.Is(err, ErrMetaTooLong) {
+		t.Errorf("expected ErrMetaTooLong, got %v", err)
+	}
+	if r.n > headerMaxLength {
+		t.Errorf("read %d bytes, more than the max header length", r.n)
+	}
+}
+
+// readHeaderByteWise is the old implementation of readHeader, kept to
+// compare with in benchmarks.
+func readHeaderByteWise(conn io.Reader) ([]byte, error) {
+	var line []byte
+	delim := []byte("\r\n")
+	buf := make([]byte, 1)
+
+	for {
+		n, err := conn.Read(buf)
+		if err == io.EOF && n <= 0 {
+			return []byte{}, err
+		} else if err != nil && err != io.EOF {
+			return []byte{}, err
+		}
+
+		line = append(line, buf...)
+		if bytes.HasSuffix(line, delim) {
+			return line[:len(line)-len(delim)], nil
+		}
+	}
+}
+
+func benchmarkResponses() map[string][]byte {
+	body := strings.Repeat("Some text\r\n", 100)
+	return map[string][]byte{
+		"short": []byte("20 text/gemini\r\n" + body),
+		"long":  []byte("31 gemini://example.com/" + strings.Repeat("a", MetaMaxLength-24) + "\r\n" + body),
+	}
+}
+
+func BenchmarkReadHeader(b *testing.B) {
+	for name, data := range benchmarkResponses() {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, _, err := readHeader(bytes.NewReader(data), false); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkReadHeaderByteWise(b *testing.B) {
+	for name, data := range benchmarkResponses() {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := readHeaderByteWise(bytes.NewReader(data)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
 func parse(s string) *url.URL {
 	p, _ := url.Parse(s)
 	return p
@@ -175,3 +298,291 @@ func TestGetPunycodeURL(t *testing.T) {
 		}
 	}
 }
+
+// newTestCert returns a self-signed certificate valid for localhost and
+// 127.0.0.1.
+func newTestCert(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create cert: %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// newTestServer starts a TLS server on localhost that calls handler for
+// every connection, and returns its address. The server is stopped when the
+// test ends.
+func newTestServer(t *testing.T, handler func(conn net.Conn)) string {
+	t.Helper()
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{newTestCert(t)},
+	})
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				handler(conn)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// readRequest reads the request line sent by the client.
+func readRequest(conn net.Conn) string {
+	line, _, _ := readHeader(conn, false)
+	return string(line)
+}
+
+func TestFetch(t *testing.T) {
+	addr := newTestServer(t, func(conn net.Conn) {
+		fmt.Fprintf(conn, "20 text/plain\r\n%s", readRequest(conn))
+	})
+
+	res, err := (&Client{}).Fetch("gemini://" + addr + "/path")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer res.Body.Close()
+	if res.Status != StatusSuccess || res.Meta != "text/plain" {
+		t.Errorf("unexpected header: %d %s", res.Status, res.Meta)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("failed to read body: %v", err)
+	}
+	if string(body) != "gemini://"+addr+"/path" {
+		t.Errorf("server got unexpected request %q", body)
+	}
+}
+
+func TestFetchStrict(t *testing.T) {
+	addr := newTestServer(t, func(conn net.Conn) {
+		readRequest(conn)
+		conn.Write([]byte("20\ttext/gemini\r\n"))
+	})
+
+	res, err := (&Client{}).Fetch("gemini://" + addr + "/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res.Body.Close()
+
+	if _, err := (&Client{Strict: true}).Fetch("gemini://" + addr + "/"); !errors.Is(err, ErrHeaderSpace) {
+		t.Errorf("expected ErrHeaderSpace, got %v", err)
+	}
+}
+
+func TestFetchConnectionState(t *testing.T) {
+	addr := newTestServer(t, func(conn net.Conn) {
+		readRequest(conn)
+		conn.Write([]byte("20 text/plain\r\n"))
+	})
+
+	res, err := (&Client{}).Fetch("gemini://" + addr + "/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer res.Body.Close()
+	if res.TLS == nil {
+		t.Fatal("TLS is nil")
+	}
+	if !res.TLS.HandshakeComplete || res.TLS.Version < tls.VersionTLS12 {
+		t.Errorf("unexpected TLS state: %+v", res.TLS)
+	}
+	if len(res.TLS.PeerCertificates) == 0 || res.TLS.PeerCertificates[0] != res.Cert {
+		t.Errorf("peer certs don't start with the response cert")
+	}
+	if res.RemoteAddr != addr {
+		t.Errorf("expected remote address %s, got %s", addr, res.RemoteAddr)
+	}
+}
+
+func TestClientTLSConfig(t *testing.T) {
+	addr := newTestServer(t, func(conn net.Conn) {
+		readRequest(conn)
+		conn.Write([]byte("20 text/plain\r\n"))
+	})
+	fetch := func(client *Client) (*Response, error) {
+		res, err := client.Fetch("gemini://" + addr + "/")
+		if err == nil {
+			res.Body.Close()
+		}
+		return res, err
+	}
+
+	called := false
+	conf := &tls.Config{
+		MaxVersion: tls.VersionTLS12,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			called = len(rawCerts) > 0
+			return nil
+		},
+	}
+	res, err := fetch(&Client{TLSConfig: conf})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.TLS.Version != tls.VersionTLS12 {
+		t.Errorf("expected TLS 1.2, got %x", res.TLS.Version)
+	}
+	if !called {
+		t.Errorf("VerifyPeerCertificate was not called")
+	}
+	if conf.InsecureSkipVerify || conf.MinVersion != 0 {
+		t.Errorf("TLSConfig was modified")
+	}
+
+	res, err = fetch(&Client{TLSConfig: &tls.Config{MinVersion: tls.VersionTLS13}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.TLS.Version != tls.VersionTLS13 {
+		t.Errorf("expected TLS 1.3, got %x", res.TLS.Version)
+	}
+
+	// The server cert is self-signed, so it's its own CA
+	roots := x509.NewCertPool()
+	roots.AddCert(res.Cert)
+	if _, err := fetch(&Client{TLSConfig: &tls.Config{RootCAs: roots}}); err != nil {
+		t.Errorf("unexpected error with the server cert as a root: %v", err)
+	}
+	other := x509.NewCertPool()
+	other.AddCert(newTestX509Cert(t))
+	if _, err := fetch(&Client{TLSConfig: &tls.Config{RootCAs: other}}); !errors.Is(err, ErrUnknownAuthority) {
+		t.Errorf("expected ErrUnknownAuthority, got %v", err)
+	}
+	if _, err := fetch(&Client{Insecure: true, TLSConfig: &tls.Config{RootCAs: other}}); err != nil {
+		t.Errorf("unexpected error with Insecure set: %v", err)
+	}
+}
+
+func TestClientKeyLog(t *testing.T) {
+	addr := newTestServer(t, func(conn net.Conn) {
+		readRequest(conn)
+		conn.Write([]byte("20 text/plain\r\n"))
+	})
+	fetch := func(client *Client) {
+		t.Helper()
+		res, err := client.Fetch("gemini://" + addr + "/")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		res.Body.Close()
+	}
+
+	path := filepath.Join(t.TempDir(), "keys")
+	t.Setenv("SSLKEYLOGFILE", path)
+	// The file is only opened once, so start over with the new variable
+	oldKeyLogFile := keyLogFile
+	keyLogFile = sync.OnceValue(openKeyLogFile)
+	t.Cleanup(func() {
+		if f, ok := keyLogFile().(*os.File); ok {
+			f.Close()
+		}
+		keyLogFile = oldKeyLogFile
+	})
+
+	fetch(&Client{NoKeyLogFile: true, SessionCacheSize: -1})
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("key log file was created with NoKeyLogFile set")
+	}
+
+	var buf bytes.Buffer
+	fetch(&Client{KeyLogWriter: &buf, SessionCacheSize: -1})
+	if !strings.Contains(buf.String(), "CLIENT_") {
+		t.Errorf("no keys were written to KeyLogWriter: %q", buf.String())
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("key log file was created with KeyLogWriter set")
+	}
+
+	fetch(&Client{SessionCacheSize: -1})
+	first, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read key log file: %v", err)
+	}
+	fetch(&Client{SessionCacheSize: -1})
+	second, _ := ioutil.ReadFile(path)
+	if len(first) == 0 || len(second) <= len(first) {
+		t.Errorf("keys were not written for every connection: %d then %d bytes", len(first), len(second))
+	}
+}
+
+func TestFetchContextCanceledBeforeHeader(t *testing.T) {
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+	addr := newTestServer(t, func(conn net.Conn) {
+		readRequest(conn)
+		<-done // Never respond
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := (&Client{}).FetchContext(ctx, "gemini://"+addr+"/")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded error, got %v", err)
+	}
+}
+
+func TestFetchContextCanceledDuringBody(t *testing.T) {
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+	addr := newTestServer(t, func(conn net.Conn) {
+		readRequest(conn)
+		fmt.Fprint(conn, "20 text/plain\r\nstart")
+		<-done // Stream forever
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	res, err := (&Client{}).FetchContext(ctx, "gemini://"+addr+"/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer res.Body.Close()
+
+	time.AfterFunc(50*time.Millisecond, cancel)
+	_, err = ioutil.ReadAll(res.Body)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected canceled error, got %v", err)
+	}
+}
+
+func TestFetchCertStoreMismatch(t *testing.T) {
+	addr := newTestServer(t, func(conn net.Conn) {
+		readRequest(conn)
+		fmt.Fprint(conn, "20 text/plain\r\n")
+	})
+
+	store := NewTOFUStore()
+	if err := store.Trust(addr, newTestX509Cert(t)); err != nil {
+		t.Fatalf("failed to pin cert: %v", err)
+	}
+	_, err := (&Client{CertStore: store}).Fetch("gemini://" + addr + "/")
+	var mismatch *CertMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("expected *CertMismatchError, got %v", err)
+	}
+}
@@ -1,8 +1,9 @@
 // Package gemini provides an easy interface to create client and servers that
 // speak the Gemini protocol.
 //
-// At the moment, this library is client-side only, and support is not guaranteed.
-// It is mostly a personal library.
+// Clients are made with Client and the Fetch functions, and servers with Server,
+// which passes requests to a Handler such as ServeMux. Support is not guaranteed,
+// it is mostly a personal library.
 //
 // It will automatically handle URLs that have IDNs in them, ie domains with Unicode.
 // It will convert to punycode for DNS and for sending to the server, but accept
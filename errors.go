@@ -0,0 +1,111 @@
+package gemini
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrURLTooLong is returned when the request URL is longer than
+	// URLMaxLength after punycoding.
+	ErrURLTooLong = errors.New("url is too long")
+
+	// ErrNoURL is returned by Client.Do when the request has no URL.
+	ErrNoURL = errors.New("request has no URL")
+
+	// ErrInvalidStatus is used when a status is not valid. For clients it is
+	// wrapped in an Error if the status is out of range, and in a *HeaderError
+	// if the status is not a number. For servers it is returned by
+	// ResponseWriter.WriteHeader when the status is not defined by the spec.
+	ErrInvalidStatus = errors.New("invalid status code")
+
+	// ErrMetaTooLong is used when a meta string is longer than MetaMaxLength.
+	// For clients it is wrapped in a *HeaderError, also when the header
+	// doesn't end within the max length, and for servers it is returned by
+	// ResponseWriter.WriteHeader.
+	ErrMetaTooLong = errors.New("meta string is too long")
+
+	// ErrMalformedHeader is wrapped in a *HeaderError when the response header
+	// is not formatted correctly.
+	ErrMalformedHeader = errors.New("header not formatted correctly")
+
+	// The following errors are wrapped in a *HeaderError when Client.Strict is
+	// set and the header breaks the rule they describe.
+
+	// ErrStatusDigits means the status is not exactly two digits.
+	ErrStatusDigits = errors.New("status is not two digits")
+	// ErrHeaderSpace means the status is not followed by exactly one space.
+	ErrHeaderSpace = errors.New("status is not followed by exactly one space")
+	// ErrHeaderLineBreak means the header contains a CR or LF before the
+	// CRLF that ends it, or is ended by an LF alone.
+	ErrHeaderLineBreak = errors.New("header contains a stray line break")
+	// ErrMetaNotUTF8 means the meta string is not valid UTF-8.
+	ErrMetaNotUTF8 = errors.New("meta string is not valid UTF-8")
+	// ErrMetaMediaType means the meta string of a success response is not a
+	// valid MIME type.
+	ErrMetaMediaType = errors.New("meta string is not a valid MIME type")
+
+	// ErrHostnameMismatch is wrapped in a *CertError when the server cert is
+	// not valid for the hostname that was connected to.
+	ErrHostnameMismatch = errors.New("hostname does not verify")
+
+	// ErrCertNotYetValid is wrapped in a *CertError when the server cert is
+	// only valid in the future.
+	ErrCertNotYetValid = errors.New("server cert is for the future")
+
+	// ErrCertExpired is wrapped in a *CertError when the server cert has
+	// expired.
+	ErrCertExpired = errors.New("server cert is expired")
+
+	// ErrUnknownAuthority is wrapped in a *CertError when Client.TLSConfig has
+	// RootCAs, and the server cert is not signed by any of them.
+	ErrUnknownAuthority = errors.New("server cert is not signed by a trusted CA")
+)
+
+// CertError is returned when the server cert fails one of the checks made by
+// the Client. Err wraps one of ErrHostnameMismatch, ErrCertNotYetValid,
+// ErrCertExpired or ErrUnknownAuthority, so errors.Is can be used to find out
+// which check failed.
+type CertError struct {
+	// Cert is the cert presented by the server.
+	Cert *x509.Certificate
+	// Host is the host:port that was connected to.
+	Host string
+	Err  error
+}
+
+func (e *CertError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *CertError) Unwrap() error {
+	return e.Err
+}
+
+// HeaderError is returned when the response header from a server is invalid.
+// Err wraps one of ErrMalformedHeader, ErrInvalidStatus or ErrMetaTooLong, or
+// when Client.Strict is set, one of the errors for the rule that was broken,
+// like ErrStatusDigits.
+type HeaderError struct {
+	// Line is the raw header line, without the CRLF.
+	Line string
+	Err  error
+}
+
+func (e *HeaderError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *HeaderError) Unwrap() error {
+	return e.Err
+}
+
+// certError returns a *CertError wrapping the sentinel, and optionally the
+// underlying error.
+func certError(cert *x509.Certificate, host string, sentinel, err error) *CertError {
+	if err == nil {
+		return &CertError{Cert: cert, Host: host, Err: sentinel}
+	}
+	return &CertError{Cert: cert, Host: host, Err: fmt.Errorf("%w: %w", sentinel, err)}
+}
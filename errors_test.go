@@ -0,0 +1,127 @@
+package gemini
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHeaderErrors(t *testing.T) {
+	tests := []struct {
+		header   string
+		expected error
+	}{
+		{"20\r\n", ErrMalformedHeader},
+		{"AA meta\r\n", ErrInvalidStatus},
+		{"20 " + strings.Repeat("a", MetaMaxLength+1) + "\r\n", ErrMetaTooLong},
+	}
+	for _, tc := range tests {
+		_, _, err := getHeader(strings.NewReader(tc.header), false)
+		var headerErr *HeaderError
+		if !errors.As(err, &headerErr) || !errors.Is(err, tc.expected) {
+			t.Errorf("%q: expected *HeaderError wrapping %v, got %v", tc.header, tc.expected, err)
+			continue
+		}
+		if headerErr.Line != strings.TrimSuffix(tc.header, "\r\n") {
+			t.Errorf("%q: unexpected line in error: %q", tc.header, headerErr.Line)
+		}
+	}
+}
+
+func TestStrictHeaderErrors(t *testing.T) {
+	tests := []struct {
+		header   string
+		expected error
+	}{
+		{"20 text/gemini\r\n", nil},
+		{"20 \r\n", nil},
+		{"51 Not found\r\n", nil},
+		{"30 gemini://example.com/ page\r\n", nil},
+		{"20\ttext/gemini\r\n", ErrHeaderSpace},
+		{"20  text/gemini\r\n", ErrHeaderSpace},
+		{"20\r\n", ErrHeaderSpace},
+		{"020 text/gemini\r\n", ErrStatusDigits},
+		{"2 text/gemini\r\n", ErrStatusDigits},
+		{"AA meta\r\n", ErrStatusDigits},
+		{"51 Not\nfound\r\n", ErrHeaderLineBreak},
+		{"20 text/gemini\nhello\n", ErrHeaderLineBreak},
+		{"20 text/gemini\n" + strings.Repeat("hello\n", 200), ErrHeaderLineBreak},
+		{"51 Not \xff found\r\n", ErrMetaNotUTF8},
+		{"20 gemini\r\n", ErrMetaMediaType},
+		{"20 text/plain; charset\r\n", ErrMetaMediaType},
+	}
+	for _, tc := range tests {
+		_, _, err := getHeader(strings.NewReader(tc.header), true)
+		if tc.expected == nil {
+			if err != nil {
+				t.Errorf("%q: unexpected error: %v", tc.header, err)
+			}
+			continue
+		}
+		var headerErr *HeaderError
+		if !errors.As(err, &headerErr) || !errors.Is(err, tc.expected) {
+			t.Errorf("%q: expected *HeaderError wrapping %v, got %v", tc.header, tc.expected, err)
+		}
+	}
+
+	// Lenient mode still accepts what strict mode doesn't
+	if _, _, err := getHeader(strings.NewReader("20\ttext/gemini\r\n"), false); err != nil {
+		t.Errorf("unexpected error in lenient mode: %v", err)
+	}
+}
+
+func TestCertErrors(t *testing.T) {
+	cert := newTestX509Cert(t)
+
+	err := (&Client{NoTimeCheck: true}).verifyCert("example.com:1965", []*x509.Certificate{cert})
+	var certErr *CertError
+	if !errors.As(err, &certErr) || !errors.Is(err, ErrHostnameMismatch) {
+		t.Fatalf("expected hostname mismatch *CertError, got %v", err)
+	}
+	if certErr.Cert != cert || certErr.Host != "example.com:1965" {
+		t.Errorf("unexpected *CertError fields: %+v", certErr)
+	}
+	var hostnameErr x509.HostnameError
+	if !errors.As(err, &hostnameErr) {
+		t.Errorf("expected underlying x509.HostnameError to be kept")
+	}
+
+	expired := *cert
+	expired.NotAfter = time.Now().Add(-time.Minute)
+	if err := (&Client{NoHostnameCheck: true}).verifyCert("localhost:1965", []*x509.Certificate{&expired}); !errors.Is(err, ErrCertExpired) {
+		t.Errorf("expected ErrCertExpired, got %v", err)
+	}
+
+	future := *cert
+	future.NotBefore = time.Now().Add(time.Hour)
+	if err := (&Client{NoHostnameCheck: true}).verifyCert("localhost:1965", []*x509.Certificate{&future}); !errors.Is(err, ErrCertNotYetValid) {
+		t.Errorf("expected ErrCertNotYetValid, got %v", err)
+	}
+}
+
+func TestErrorIs(t *testing.T) {
+	err := fmt.Errorf("wrapped: %w", Error{Err: ErrInvalidStatus, Status: 99})
+
+	if !errors.Is(err, Error{Status: 99}) {
+		t.Errorf("expected match on status")
+	}
+	if !errors.Is(err, &Error{Status: 99, Err: ErrInvalidStatus}) {
+		t.Errorf("expected match on status and error")
+	}
+	if errors.Is(err, Error{Status: 51}) {
+		t.Errorf("expected no match on different status")
+	}
+	if !errors.Is(err, ErrInvalidStatus) {
+		t.Errorf("expected wrapped error to match")
+	}
+}
+
+func TestURLTooLong(t *testing.T) {
+	_, err := (&Client{}).Fetch("gemini://example.invalid/" + strings.Repeat("a", URLMaxLength))
+	if !errors.Is(err, ErrURLTooLong) {
+		t.Errorf("expected ErrURLTooLong, got %v", err)
+	}
+}
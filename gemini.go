@@ -1,6 +1,7 @@
 package gemini
 
 import (
+	"errors"
 	"fmt"
 	"net/url"
 	"strings"
@@ -123,6 +124,12 @@ func QueryUnescape(query string) (string, error) {
 	return url.PathUnescape(query)
 }
 
+// Error is an error that is related to a response status.
+//
+// It can be matched by status with errors.Is, by using an Error with the same
+// status and no Err as the target:
+//
+//	errors.Is(err, gemini.Error{Status: gemini.StatusSlowDown})
 type Error struct {
 	Err    error
 	Status int
@@ -135,3 +142,21 @@ func (e Error) Error() string {
 func (e Error) Unwrap() error {
 	return e.Err
 }
+
+// Is reports whether target is an Error or *Error with the same status and
+// either no Err or an Err that matches e.Err.
+func (e Error) Is(target error) bool {
+	var t Error
+	switch v := target.(type) {
+	case Error:
+		t = v
+	case *Error:
+		if v == nil {
+			return false
+		}
+		t = *v
+	default:
+		return false
+	}
+	return t.Status == e.Status && (t.Err == nil || errors.Is(e.Err, t.Err))
+}
@@ -0,0 +1,96 @@
+package gemini
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+var (
+	// ErrProxyRefused is wrapped in a *ProxyError when a Gemini proxy refuses
+	// to proxy a request, with StatusProxyRequestRefused.
+	ErrProxyRefused = errors.New("proxy request refused")
+
+	// ErrProxyFailed is wrapped in a *ProxyError when a Gemini proxy fails to
+	// get the resource, with StatusProxyError.
+	ErrProxyFailed = errors.New("proxy failed to get resource")
+)
+
+// GeminiProxyFunc returns the host of the Gemini proxy that the request for u
+// should be sent to, as "host:port". If the port is missing, 1965 is assumed.
+// It returns an empty string if the request shouldn't be proxied.
+// See Client.GeminiProxy.
+type GeminiProxyFunc func(u *url.URL) (string, error)
+
+// GeminiProxySchemes returns a GeminiProxyFunc that sends requests for URLs
+// with the schemes in hosts to the matching proxy. URLs with other schemes are
+// not proxied. For example, this sends gopher and https requests to a proxy
+// running on localhost:
+//
+//	GeminiProxySchemes(map[string]string{
+//		"gopher": "localhost:1965",
+//		"https":  "localhost:1965",
+//	})
+func GeminiProxySchemes(hosts map[string]string) GeminiProxyFunc {
+	m := make(map[string]string, len(hosts))
+	for scheme, host := range hosts {
+		m[strings.ToLower(scheme)] = host
+	}
+	return func(u *url.URL) (string, error) {
+		return m[strings.ToLower(u.Scheme)], nil
+	}
+}
+
+// ProxyError is returned when a request sent to a proxy by Client.GeminiProxy
+// gets a response with StatusProxyRequestRefused or StatusProxyError. Err is
+// ErrProxyRefused or ErrProxyFailed respectively.
+type ProxyError struct {
+	// Proxy is the host:port of the proxy.
+	Proxy string
+	// URL is the URL that was requested.
+	URL    string
+	Status int
+	Meta   string
+	Err    error
+}
+
+func (e *ProxyError) Error() string {
+	if e.Meta == "" {
+		return fmt.Sprintf("%v: %s via %s", e.Err, e.URL, e.Proxy)
+	}
+	return fmt.Sprintf("%v: %s via %s: %s", e.Err, e.URL, e.Proxy, e.Meta)
+}
+
+func (e *ProxyError) Unwrap() error {
+	return e.Err
+}
+
+// geminiProxy returns the proxy to send the request for u to, or an empty
+// string if it isn't proxied. host is the host:port the request would
+// otherwise be sent to.
+func (c *Client) geminiProxy(u *url.URL, host string) (string, error) {
+	if c.GeminiProxy == nil || host != getHost(u) {
+		// No proxying, or the request already has a different host set
+		return "", nil
+	}
+	proxy, err := c.GeminiProxy(u)
+	if err != nil || proxy == "" {
+		return "", err
+	}
+	return fullHost(proxy)
+}
+
+// proxyError returns a *ProxyError if res is a proxy failure, otherwise nil.
+func proxyError(proxy string, u *url.URL, res *Response) error {
+	var err error
+	switch res.Status {
+	case StatusProxyRequestRefused:
+		err = ErrProxyRefused
+	case StatusProxyError:
+		err = ErrProxyFailed
+	default:
+		return nil
+	}
+	return &ProxyError{Proxy: proxy, URL: u.String(), Status: res.Status, Meta: res.Meta, Err: err}
+}
@@ -0,0 +1,103 @@
+package gemini
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func newGeminiProxyServer(t *testing.T, name string) string {
+	return newTestServer(t, func(conn net.Conn) {
+		req := readRequest(conn)
+		switch {
+		case strings.HasSuffix(req, "/refuse"):
+			fmt.Fprint(conn, "53 No proxying to that host\r\n")
+		case strings.HasSuffix(req, "/fail"):
+			fmt.Fprint(conn, "43 Upstream timed out\r\n")
+		default:
+			fmt.Fprintf(conn, "20 text/plain\r\n%s %s", name, req)
+		}
+	})
+}
+
+func TestGeminiProxy(t *testing.T) {
+	proxy := newGeminiProxyServer(t, "proxy")
+	direct := newGeminiProxyServer(t, "direct")
+	client := &Client{GeminiProxy: GeminiProxySchemes(map[string]string{
+		"gopher": proxy,
+		"HTTPS":  proxy,
+	})}
+
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{"gopher://example.com/1/", "proxy gopher://example.com/1/"},
+		{"https://example.com/", "proxy https://example.com/"},
+		{"gemini://" + direct + "/", "direct gemini://" + direct + "/"},
+	}
+	for _, tt := range tests {
+		res, err := client.Fetch(tt.url)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.url, err)
+			continue
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if string(body) != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.url, tt.expected, body)
+		}
+	}
+
+	// An explicit host isn't overridden
+	res, err := client.FetchWithHost(direct, "https://example.com/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if string(body) != "direct https://example.com/" {
+		t.Errorf("request with host was proxied: %q", body)
+	}
+}
+
+func TestGeminiProxyErrors(t *testing.T) {
+	proxy := newGeminiProxyServer(t, "proxy")
+	client := &Client{GeminiProxy: func(u *url.URL) (string, error) {
+		return proxy, nil
+	}}
+
+	_, err := client.Fetch("https://example.com/refuse")
+	var proxyErr *ProxyError
+	if !errors.As(err, &proxyErr) || !errors.Is(err, ErrProxyRefused) {
+		t.Fatalf("expected *ProxyError wrapping ErrProxyRefused, got %v", err)
+	}
+	if proxyErr.Status != StatusProxyRequestRefused || proxyErr.Proxy != proxy ||
+		proxyErr.URL != "https://example.com/refuse" || proxyErr.Meta != "No proxying to that host" {
+		t.Errorf("unexpected *ProxyError fields: %+v", proxyErr)
+	}
+
+	if _, err := client.Fetch("https://example.com/fail"); !errors.Is(err, ErrProxyFailed) {
+		t.Errorf("expected ErrProxyFailed, got %v", err)
+	}
+
+	// Without GeminiProxy, the responses are returned as is
+	res, err := (&Client{}).FetchWithHost(proxy, "https://example.com/refuse")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res.Body.Close()
+	if res.Status != StatusProxyRequestRefused {
+		t.Errorf("expected status 53, got %d", res.Status)
+	}
+
+	fault := errors.New("no proxy")
+	client.GeminiProxy = func(u *url.URL) (string, error) { return "", fault }
+	if _, err := client.Fetch("https://example.com/"); !errors.Is(err, fault) {
+		t.Errorf("expected GeminiProxy error, got %v", err)
+	}
+}
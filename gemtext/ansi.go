@@ -0,0 +1,249 @@
+package gemtext
+
+import (
+	"io"
+	"strings"
+	"unicode"
+)
+
+// DefaultWidth is the width ANSIRenderer wraps text at if Width is not set.
+const DefaultWidth = 80
+
+// SGR codes used by ANSIRenderer
+const (
+	ansiReset     = "\x1b[0m"
+	ansiBold      = "\x1b[1m"
+	ansiFaint     = "\x1b[2m"
+	ansiItalic    = "\x1b[3m"
+	ansiUnderline = "\x1b[4m"
+	ansiBlue      = "\x1b[34m"
+)
+
+// ANSIRenderer renders documents for display in a terminal, with word
+// wrapping and styling using ANSI escape codes. Control characters in the
+// document are removed, so documents can't send their own escape codes to
+// the terminal.
+type ANSIRenderer struct {
+	// Width is the number of columns to wrap text at. If it's 0, DefaultWidth
+	// is used. Preformatted text is never wrapped.
+	Width int
+
+	// NoColor disables all styling, so the output is plain text.
+	NoColor bool
+
+	// LinkURL, if set, is used to get the URL shown for every link.
+	LinkURL LinkURLFunc
+
+	w io.Writer
+}
+
+// NewANSIRenderer returns an ANSIRenderer that writes to w.
+func NewANSIRenderer(w io.Writer) *ANSIRenderer {
+	return &ANSIRenderer{w: w}
+}
+
+// WriteLine implements Renderer.
+func (r *ANSIRenderer) WriteLine(line Line) error {
+	var b strings.Builder
+
+	switch l := line.(type) {
+	case PreformatToggle:
+		// Preformatted lines are already known by their type
+		return nil
+	case PreformattedText:
+		b.WriteString(stripControl(string(l)) + "\n")
+	case Text:
+		r.wrap(&b, string(l), "", "", "")
+	case Link:
+		u := linkURL(r.LinkURL, l)
+		text := r.style(ansiBlue+ansiUnderline, stripControl(linkLabel(l, u)))
+		if l.Label != "" {
+			text += " " + r.style(ansiFaint, stripControl(u))
+		}
+		// Styles are applied before wrapping, so the link is wrapped as a whole
+		r.wrapStyled(&b, text, "=> ", "   ")
+	case Heading:
+		style := ansiBold
+		if l.Level == 1 {
+			style += ansiUnderline
+		}
+		r.wrap(&b, l.Text, style, "", "")
+	case ListItem:
+		r.wrap(&b, string(l), "", "• ", "  ")
+	case Quote:
+		r.wrap(&b, quoteText(l), ansiItalic, "> ", "> ")
+	}
+	_, err := io.WriteString(r.w, b.String())
+	return err
+}
+
+// Close implements Renderer.
+func (r *ANSIRenderer) Close() error {
+	return nil
+}
+
+// style wraps s in the SGR codes, unless NoColor is set.
+func (r *ANSIRenderer) style(codes, s string) string {
+	if r.NoColor || codes == "" || s == "" {
+		return s
+	}
+	return codes + s + ansiReset
+}
+
+// wrap writes the text word wrapped, with each line styled. The first line
+// starts with prefix, and the following ones with indent.
+func (r *ANSIRenderer) wrap(b *strings.Builder, text, style, prefix, indent string) {
+	for i, l := range wrapText(stripControl(text), r.width()-runeWidth(prefix)) {
+		if i == 0 {
+			b.WriteString(prefix)
+		} else {
+			b.WriteString(indent)
+		}
+		b.WriteString(r.style(style, l) + "\n")
+	}
+}
+
+// wrapStyled is like wrap, but for text that already contains SGR codes.
+// The codes are carried over to the next line when a line is wrapped.
+func (r *ANSIRenderer) wrapStyled(b *strings.Builder, text, prefix, indent string) {
+	active := ""
+	for i, l := range wrapText(text, r.width()-runeWidth(prefix)) {
+		if i == 0 {
+			b.WriteString(prefix)
+		} else {
+			b.WriteString(indent)
+		}
+		b.WriteString(active + l)
+		active = activeSGR(active + l)
+		if active != "" {
+			b.WriteString(ansiReset)
+		}
+		b.WriteString("\n")
+	}
+}
+
+func (r *ANSIRenderer) width() int {
+	if r.Width <= 0 {
+		return DefaultWidth
+	}
+	return r.Width
+}
+
+// wrapText splits text into lines of at most width columns, breaking at
+// spaces. Words longer than width are split. SGR codes don't count towards
+// the width.
+func wrapText(text string, width int) []string {
+	if width < 1 {
+		width = 1
+	}
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		return []string{""}
+	}
+
+	var lines []string
+	var line strings.Builder
+	lineWidth := 0
+	for _, word := range words {
+		ww := runeWidth(word)
+		if lineWidth > 0 && lineWidth+1+ww > width {
+			lines = append(lines, line.String())
+			line.Reset()
+			lineWidth = 0
+		}
+		for ww > width {
+			// Split long words
+			head, tail := splitAtWidth(word, width)
+			line.WriteString(head)
+			lines = append(lines, line.String())
+			line.Reset()
+			lineWidth = 0
+			word = tail
+			ww = runeWidth(word)
+		}
+		if lineWidth > 0 {
+			line.WriteByte(' ')
+			lineWidth++
+		}
+		line.WriteString(word)
+		lineWidth += ww
+	}
+	return append(lines, line.String())
+}
+
+// runeWidth returns the number of columns s takes up, ignoring SGR codes.
+func runeWidth(s string) int {
+	n := 0
+	inEscape := false
+	for _, r := range s {
+		switch {
+		case r == '\x1b':
+			inEscape = true
+		case inEscape:
+			if r == 'm' {
+				inEscape = false
+			}
+		default:
+			n++
+		}
+	}
+	return n
+}
+
+// splitAtWidth splits s after width columns, ignoring SGR codes.
+func splitAtWidth(s string, width int) (string, string) {
+	n := 0
+	inEscape := false
+	for i, r := range s {
+		switch {
+		case r == '\x1b':
+			inEscape = true
+		case inEscape:
+			if r == 'm' {
+				inEscape = false
+			}
+		default:
+			if n == width {
+				return s[:i], s[i:]
+			}
+			n++
+		}
+	}
+	return s, ""
+}
+
+// activeSGR returns the SGR codes still in effect at the end of s.
+func activeSGR(s string) string {
+	active := ""
+	for {
+		i := strings.Index(s, "\x1b[")
+		if i == -1 {
+			return active
+		}
+		j := strings.IndexByte(s[i:], 'm')
+		if j == -1 {
+			return active
+		}
+		code := s[i : i+j+1]
+		if code == ansiReset {
+			active = ""
+		} else {
+			active += code
+		}
+		s = s[i+j+1:]
+	}
+}
+
+// stripControl removes control characters, including the escape character,
+// from s. Tabs are replaced with spaces.
+func stripControl(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\t' {
+			return ' '
+		}
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
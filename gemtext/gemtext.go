@@ -0,0 +1,236 @@
+// Package gemtext parses text/gemini documents, the native document format of
+// Gemini.
+//
+// Documents are parsed line by line as they are read, so long or never ending
+// streamed documents can be handled as well.
+package gemtext
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// Line is a parsed line of a text/gemini document. It is one of the types
+// Text, Link, Heading, ListItem, Quote, PreformatToggle and PreformattedText.
+type Line interface {
+	// String returns the line as it would be written in a document, without
+	// the line ending.
+	String() string
+
+	isLine()
+}
+
+// Text is a text line.
+type Text string
+
+// Link is a link line.
+type Link struct {
+	// RawURL is the URL as written in the document.
+	RawURL string
+	// URL is RawURL parsed and resolved against the document URL. It is nil
+	// if RawURL is not a valid URL.
+	URL *url.URL
+	// Label is the optional human-friendly label for the link.
+	Label string
+}
+
+// Heading is a heading line, with a level from 1 to 3.
+type Heading struct {
+	Level int
+	Text  string
+}
+
+// ListItem is an unordered list item line.
+type ListItem string
+
+// Quote is a quote line.
+type Quote string
+
+// PreformatToggle is a line that starts or ends a preformatted block.
+// AltText is only meaningful for toggles that start a block, and may be empty.
+type PreformatToggle struct {
+	AltText string
+}
+
+// PreformattedText is a line inside a preformatted block. It is not parsed.
+type PreformattedText string
+
+func (Text) isLine()             {}
+func (Link) isLine()             {}
+func (Heading) isLine()          {}
+func (ListItem) isLine()         {}
+func (Quote) isLine()            {}
+func (PreformatToggle) isLine()  {}
+func (PreformattedText) isLine() {}
+
+func (l Text) String() string { return string(l) }
+
+func (l Link) String() string {
+	if l.Label == "" {
+		return "=> " + l.RawURL
+	}
+	return "=> " + l.RawURL + " " + l.Label
+}
+
+func (l Heading) String() string { return strings.Repeat("#", l.Level) + " " + l.Text }
+
+func (l ListItem) String() string { return "* " + string(l) }
+
+func (l Quote) String() string { return ">" + string(l) }
+
+func (l PreformatToggle) String() string { return "```" + l.AltText }
+
+func (l PreformattedText) String() string { return string(l) }
+
+// DefaultMaxLineLength is the max length of a line if Parser.MaxLineLength is
+// not set.
+const DefaultMaxLineLength = 1 << 20
+
+// ErrLineTooLong is returned by Parser.Next when a line is longer than the max
+// line length.
+var ErrLineTooLong = errors.New("gemtext: line too long")
+
+// Parser reads lines from a text/gemini document.
+type Parser struct {
+	// MaxLineLength is the max length of a line in bytes, not counting the
+	// line ending. If it's 0, DefaultMaxLineLength is used. Reading stops at a
+	// longer line, so a document that never ends a line can't use up memory.
+	MaxLineLength int
+
+	r    *bufio.Reader
+	base *url.URL
+	pre  bool  // Inside a preformatted block
+	err  error // Sticky error
+}
+
+// NewParser returns a Parser that reads the document from r. Link URLs are
+// resolved against base, which should be the URL of the document. If base is
+// nil, link URLs are parsed but not resolved.
+func NewParser(r io.Reader, base *url.URL) *Parser {
+	return &Parser{r: bufio.NewReader(r), base: base}
+}
+
+// Next returns the next line of the document. It blocks until a full line has
+// been read, or the document ends. At the end of the document it returns
+// io.EOF.
+//
+// If a line is longer than the max line length, ErrLineTooLong is returned,
+// and so are all later calls.
+func (p *Parser) Next() (Line, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	s, err := p.readLine()
+	if err != nil && (err != io.EOF || s == "") {
+		if err == ErrLineTooLong {
+			p.err = err
+		}
+		return nil, err
+	}
+	return p.parseLine(s), nil
+}
+
+// readLine reads a line and returns it without the line ending.
+func (p *Parser) readLine() (string, error) {
+	max := p.MaxLineLength
+	if max <= 0 {
+		max = DefaultMaxLineLength
+	}
+	var line []byte
+	for {
+		chunk, err := p.r.ReadSlice('\n')
+		line = append(line, chunk...)
+		// Allow room for CRLF
+		if len(line) > max+2 {
+			return "", ErrLineTooLong
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		s := strings.TrimSuffix(string(line), "\n")
+		s = strings.TrimSuffix(s, "\r")
+		if len(s) > max {
+			return "", ErrLineTooLong
+		}
+		return s, err
+	}
+}
+
+// Preformatted reports whether the parser is inside a preformatted block, so
+// the next line will be PreformattedText unless it is a toggle.
+func (p *Parser) Preformatted() bool {
+	return p.pre
+}
+
+func (p *Parser) parseLine(s string) Line {
+	if strings.HasPrefix(s, "```") {
+		p.pre = !p.pre
+		if p.pre {
+			return PreformatToggle{AltText: strings.TrimSpace(s[3:])}
+		}
+		return PreformatToggle{}
+	}
+	if p.pre {
+		return PreformattedText(s)
+	}
+
+	switch {
+	case strings.HasPrefix(s, "=>"):
+		return p.parseLink(s)
+	case strings.HasPrefix(s, "###"):
+		return Heading{Level: 3, Text: strings.TrimSpace(s[3:])}
+	case strings.HasPrefix(s, "##"):
+		return Heading{Level: 2, Text: strings.TrimSpace(s[2:])}
+	case strings.HasPrefix(s, "#"):
+		return Heading{Level: 1, Text: strings.TrimSpace(s[1:])}
+	case strings.HasPrefix(s, "* "):
+		return ListItem(s[2:])
+	case strings.HasPrefix(s, ">"):
+		return Quote(s[1:])
+	}
+	return Text(s)
+}
+
+func (p *Parser) parseLink(line string) Line {
+	s := strings.TrimLeft(line[2:], " \t")
+	if s == "" {
+		// A link line without a URL is treated as text
+		return Text(line)
+	}
+	rawURL := s
+	label := ""
+	if i := strings.IndexAny(s, " \t"); i != -1 {
+		rawURL = s[:i]
+		label = strings.TrimSpace(s[i:])
+	}
+
+	link := Link{RawURL: rawURL, Label: label}
+	u, err := url.Parse(rawURL)
+	if err == nil {
+		if p.base != nil {
+			u = p.base.ResolveReference(u)
+		}
+		link.URL = u
+	}
+	return link
+}
+
+// Parse reads and parses a whole text/gemini document. See NewParser for the
+// meaning of base.
+func Parse(r io.Reader, base *url.URL) ([]Line, error) {
+	p := NewParser(r, base)
+	var lines []Line
+	for {
+		line, err := p.Next()
+		if err == io.EOF {
+			return lines, nil
+		}
+		if err != nil {
+			return lines, err
+		}
+		lines = append(lines, line)
+	}
+}
@@ -0,0 +1,149 @@
+package gemtext
+
+import (
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func mustParseURL(s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+func TestParse(t *testing.T) {
+	doc := "# Title\r\n" +
+		"## Sub\n" +
+		"###Subsub\n" +
+		"Some text\n" +
+		"=> /about About me\n" +
+		"=>gemini://example.org/\n" +
+		"=> other.gmi\t Tabbed label\n" +
+		"=>\n" +
+		"* item\n" +
+		"*not an item\n" +
+		"> quote\n" +
+		"```go code\n" +
+		"# not a heading\n" +
+		"``` ignored\n" +
+		"last line without newline"
+
+	lines, err := Parse(strings.NewReader(doc), mustParseURL("gemini://example.com/dir/index.gmi"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []Line{
+		Heading{Level: 1, Text: "Title"},
+		Heading{Level: 2, Text: "Sub"},
+		Heading{Level: 3, Text: "Subsub"},
+		Text("Some text"),
+		Link{RawURL: "/about", URL: mustParseURL("gemini://example.com/about"), Label: "About me"},
+		Link{RawURL: "gemini://example.org/", URL: mustParseURL("gemini://example.org/")},
+		Link{RawURL: "other.gmi", URL: mustParseURL("gemini://example.com/dir/other.gmi"), Label: "Tabbed label"},
+		Text("=>"),
+		ListItem("item"),
+		Text("*not an item"),
+		Quote(" quote"),
+		PreformatToggle{AltText: "go code"},
+		PreformattedText("# not a heading"),
+		PreformatToggle{},
+		Text("last line without newline"),
+	}
+	if diff := cmp.Diff(expected, lines); diff != "" {
+		t.Errorf("unexpected lines (-want +got):\n%s", diff)
+	}
+}
+
+func TestParserStream(t *testing.T) {
+	pr, pw := io.Pipe()
+	p := NewParser(pr, nil)
+
+	go io.WriteString(pw, "```\n")
+	line, err := p.Next()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if line != (PreformatToggle{}) || !p.Preformatted() {
+		t.Errorf("expected opening preformat toggle, got %#v", line)
+	}
+
+	go func() {
+		io.WriteString(pw, "=> x\n")
+		pw.Close()
+	}()
+	line, err = p.Next()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if line != PreformattedText("=> x") {
+		t.Errorf("expected preformatted text, got %#v", line)
+	}
+	if _, err := p.Next(); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
+
+// endlessLine is a reader of a line that never ends, which counts the bytes
+// read from it.
+type endlessLine struct {
+	n int
+}
+
+func (r *endlessLine) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 'a'
+	}
+	r.n += len(p)
+	return len(p), nil
+}
+
+func TestParserMaxLineLength(t *testing.T) {
+	p := NewParser(strings.NewReader("hello\r\nhello!\nhi\n"), nil)
+	p.MaxLineLength = 5
+	if line, err := p.Next(); err != nil || line != Text("hello") {
+		t.Errorf("expected line at the max length, got %#v, %v", line, err)
+	}
+	if _, err := p.Next(); err != ErrLineTooLong {
+		t.Errorf("expected ErrLineTooLong, got %v", err)
+	}
+	if _, err := p.Next(); err != ErrLineTooLong {
+		t.Errorf("expected ErrLineTooLong to stick, got %v", err)
+	}
+
+	r := &endlessLine{}
+	p = NewParser(r, nil)
+	p.MaxLineLength = 10000
+	if _, err := p.Next(); err != ErrLineTooLong {
+		t.Errorf("expected ErrLineTooLong, got %v", err)
+	}
+	if r.n > 20000 {
+		t.Errorf("read %d bytes for a max line length of 10000", r.n)
+	}
+}
+
+func TestLineString(t *testing.T) {
+	tests := []struct {
+		line     Line
+		expected string
+	}{
+		{Text("text"), "text"},
+		{Link{RawURL: "/a"}, "=> /a"},
+		{Link{RawURL: "/a", Label: "A"}, "=> /a A"},
+		{Heading{Level: 2, Text: "H"}, "## H"},
+		{ListItem("item"), "* item"},
+		{Quote("q"), ">q"},
+		{PreformatToggle{AltText: "alt"}, "```alt"},
+	}
+	for _, tc := range tests {
+		if s := tc.line.String(); s != tc.expected {
+			t.Errorf("expected %q, got %q", tc.expected, s)
+		}
+	}
+}
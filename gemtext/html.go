@@ -0,0 +1,114 @@
+package gemtext
+
+import (
+	"html"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// HTMLRenderer renders documents as HTML. It only writes the elements for the
+// content, so the output can be embedded in a page. All text is escaped.
+type HTMLRenderer struct {
+	// LinkURL, if set, is used to get the href for every link. Links with a
+	// javascript:, vbscript: or data: URL are always rendered with "#"
+	// instead, so that documents can't inject scripts.
+	LinkURL LinkURLFunc
+
+	w     io.Writer
+	block block
+}
+
+// NewHTMLRenderer returns an HTMLRenderer that writes to w.
+func NewHTMLRenderer(w io.Writer) *HTMLRenderer {
+	return &HTMLRenderer{w: w}
+}
+
+var htmlBlockTags = map[block][2]string{
+	blockList:  {"<ul>\n", "</ul>\n"},
+	blockQuote: {"<blockquote>\n", "</blockquote>\n"},
+	blockPre:   {"<pre>\n", "</pre>\n"},
+}
+
+// WriteLine implements Renderer.
+func (r *HTMLRenderer) WriteLine(line Line) error {
+	var b strings.Builder
+
+	if toggle, ok := line.(PreformatToggle); ok {
+		r.closeBlock(&b)
+		if r.block == blockPre {
+			r.block = blockNone
+		} else {
+			// The alt text describes the block, for screen readers
+			if toggle.AltText == "" {
+				b.WriteString("<pre>\n")
+			} else {
+				b.WriteString(`<pre aria-label="` + html.EscapeString(toggle.AltText) + "\">\n")
+			}
+			r.block = blockPre
+		}
+		_, err := io.WriteString(r.w, b.String())
+		return err
+	}
+
+	if bl := blockOf(line); bl != r.block {
+		r.closeBlock(&b)
+		b.WriteString(htmlBlockTags[bl][0])
+		r.block = bl
+	}
+
+	switch l := line.(type) {
+	case Text:
+		if l == "" {
+			b.WriteString("<br>\n")
+		} else {
+			b.WriteString("<p>" + html.EscapeString(string(l)) + "</p>\n")
+		}
+	case Link:
+		href := linkURL(r.LinkURL, l)
+		if !safeHref(href) {
+			href = "#"
+		}
+		b.WriteString(`<p><a href="` + html.EscapeString(href) + `">` +
+			html.EscapeString(linkLabel(l, l.RawURL)) + "</a></p>\n")
+	case Heading:
+		tag := "h" + strconv.Itoa(l.Level)
+		b.WriteString("<" + tag + ">" + html.EscapeString(l.Text) + "</" + tag + ">\n")
+	case ListItem:
+		b.WriteString("<li>" + html.EscapeString(string(l)) + "</li>\n")
+	case Quote:
+		b.WriteString("<p>" + html.EscapeString(quoteText(l)) + "</p>\n")
+	case PreformattedText:
+		b.WriteString(html.EscapeString(string(l)) + "\n")
+	}
+	_, err := io.WriteString(r.w, b.String())
+	return err
+}
+
+// Close implements Renderer.
+func (r *HTMLRenderer) Close() error {
+	var b strings.Builder
+	r.closeBlock(&b)
+	r.block = blockNone
+	_, err := io.WriteString(r.w, b.String())
+	return err
+}
+
+// closeBlock writes the closing tag of the current block, if there is one.
+func (r *HTMLRenderer) closeBlock(b *strings.Builder) {
+	b.WriteString(htmlBlockTags[r.block][1])
+}
+
+// safeHref reports whether the URL can't be used to run scripts.
+func safeHref(href string) bool {
+	u, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "javascript", "vbscript", "data":
+		return false
+	}
+	return true
+}
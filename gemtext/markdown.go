@@ -0,0 +1,118 @@
+package gemtext
+
+import (
+	"io"
+	"regexp"
+	"strings"
+)
+
+// MarkdownRenderer renders documents as CommonMark. Text is escaped so that it
+// isn't interpreted as Markdown syntax.
+type MarkdownRenderer struct {
+	// LinkURL, if set, is used to get the URL for every link.
+	LinkURL LinkURLFunc
+
+	w       io.Writer
+	block   block
+	started bool // Whether anything has been written
+	pre     bool
+}
+
+// NewMarkdownRenderer returns a MarkdownRenderer that writes to w.
+func NewMarkdownRenderer(w io.Writer) *MarkdownRenderer {
+	return &MarkdownRenderer{w: w}
+}
+
+// WriteLine implements Renderer.
+func (r *MarkdownRenderer) WriteLine(line Line) error {
+	var b strings.Builder
+
+	if toggle, ok := line.(PreformatToggle); ok {
+		if r.pre {
+			b.WriteString("```\n")
+			r.pre = false
+		} else {
+			r.separate(&b, blockPre)
+			// Backticks aren't allowed in the info string of a fenced block
+			b.WriteString("```" + strings.ReplaceAll(toggle.AltText, "`", "") + "\n")
+			r.pre = true
+		}
+		_, err := io.WriteString(r.w, b.String())
+		return err
+	}
+	if r.pre {
+		// Other lines can be written in a block too, they are written as is
+		_, err := io.WriteString(r.w, line.String()+"\n")
+		return err
+	}
+
+	switch l := line.(type) {
+	case Text:
+		if l == "" {
+			// Paragraphs are already separated
+			r.block = blockNone
+			return nil
+		}
+		r.separate(&b, blockNone)
+		b.WriteString(escapeMarkdown(string(l)) + "\n")
+	case Link:
+		u := linkURL(r.LinkURL, l)
+		r.separate(&b, blockNone)
+		b.WriteString("[" + escapeMarkdown(linkLabel(l, l.RawURL)) + "](<" + escapeMarkdownURL(u) + ">)\n")
+	case Heading:
+		r.separate(&b, blockNone)
+		b.WriteString(strings.Repeat("#", l.Level) + " " + escapeMarkdown(l.Text) + "\n")
+	case ListItem:
+		r.separate(&b, blockList)
+		b.WriteString("- " + escapeMarkdown(string(l)) + "\n")
+	case Quote:
+		r.separate(&b, blockQuote)
+		b.WriteString("> " + escapeMarkdown(quoteText(l)) + "\n")
+	}
+	_, err := io.WriteString(r.w, b.String())
+	return err
+}
+
+// Close implements Renderer.
+func (r *MarkdownRenderer) Close() error {
+	if r.pre {
+		r.pre = false
+		_, err := io.WriteString(r.w, "```\n")
+		return err
+	}
+	return nil
+}
+
+// separate writes a blank line between blocks, unless the line continues a
+// list or quote.
+func (r *MarkdownRenderer) separate(b *strings.Builder, bl block) {
+	if r.started && (bl == blockNone || bl != r.block) {
+		b.WriteString("\n")
+	}
+	r.started = true
+	r.block = bl
+}
+
+var (
+	markdownEscaper = strings.NewReplacer(
+		`\`, `\\`, "`", "\\`", `*`, `\*`, `_`, `\_`, `[`, `\[`, `]`, `\]`,
+		`<`, `\<`, `>`, `\>`, `#`, `\#`, `|`, `\|`, `~`, `\~`, `&`, `\&`,
+	)
+	// Line starts that would make a list item or thematic break
+	markdownLineStart = regexp.MustCompile(`^(\s*)([-+=]|\d+[.)])`)
+)
+
+// escapeMarkdown escapes text so it is rendered literally.
+func escapeMarkdown(s string) string {
+	s = markdownEscaper.Replace(s)
+	return markdownLineStart.ReplaceAllStringFunc(s, func(m string) string {
+		i := len(m) - 1
+		return m[:i] + `\` + m[i:]
+	})
+}
+
+// escapeMarkdownURL escapes a URL so it can be used as a link destination
+// inside angle brackets.
+func escapeMarkdownURL(s string) string {
+	return strings.NewReplacer("<", "%3C", ">", "%3E", "\n", "", "\r", "").Replace(s)
+}
@@ -0,0 +1,87 @@
+package gemtext
+
+import (
+	"io"
+	"strings"
+)
+
+// Renderer writes a document in another format, one line at a time, so that
+// documents can be rendered while they are being streamed.
+type Renderer interface {
+	// WriteLine renders the line. Lines must be passed in document order.
+	WriteLine(line Line) error
+
+	// Close finishes the document, for example by closing any elements that
+	// are still open. It does not close the underlying writer.
+	Close() error
+}
+
+// Render writes all the lines read by p to r, and then closes r.
+func Render(r Renderer, p *Parser) error {
+	for {
+		line, err := p.Next()
+		if err == io.EOF {
+			return r.Close()
+		}
+		if err != nil {
+			return err
+		}
+		if err := r.WriteLine(line); err != nil {
+			return err
+		}
+	}
+}
+
+// LinkURLFunc returns the URL to use when rendering a link. It can be used to
+// rewrite URLs, for example to point gemini:// URLs at an HTTP proxy.
+type LinkURLFunc func(link Link) string
+
+// linkURL returns the URL for the link, using f if it's not nil.
+func linkURL(f LinkURLFunc, link Link) string {
+	if f != nil {
+		return f(link)
+	}
+	if link.URL != nil {
+		return link.URL.String()
+	}
+	return link.RawURL
+}
+
+// linkLabel returns the label of the link, or its URL if there is no label.
+func linkLabel(link Link, url string) string {
+	if link.Label == "" {
+		return url
+	}
+	return link.Label
+}
+
+// block is a kind of multi-line element that consecutive lines are grouped
+// into by renderers.
+type block int
+
+const (
+	blockNone block = iota
+	blockList
+	blockQuote
+	blockPre
+)
+
+// blockOf returns the block the line belongs to. Preformat toggles are
+// handled separately by renderers.
+func blockOf(line Line) block {
+	switch line.(type) {
+	case ListItem:
+		return blockList
+	case Quote:
+		return blockQuote
+	case PreformattedText:
+		return blockPre
+	}
+	return blockNone
+}
+
+// quoteText returns the text of a quote line, without the optional space
+// after the > character.
+func quoteText(q Quote) string {
+	return strings.TrimPrefix(string(q), " ")
+}
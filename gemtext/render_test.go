@@ -0,0 +1,156 @@
+package gemtext
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+const renderDoc = `# Title <1>
+Text & more
+=> /a?x=1&y=2 Link "A"
+=> javascript:alert(1) Bad
+* one
+* two
+> quoted
+` + "```alt\n  <pre>\n```\n" + `
+last`
+
+func render(t *testing.T, r Renderer) {
+	t.Helper()
+	if err := Render(r, NewParser(strings.NewReader(renderDoc), mustParseURL("gemini://example.com/"))); err != nil {
+		t.Fatalf("failed to render: %v", err)
+	}
+}
+
+func TestHTMLRenderer(t *testing.T) {
+	var b strings.Builder
+	r := NewHTMLRenderer(&b)
+	r.LinkURL = func(link Link) string {
+		if link.URL.Scheme == "gemini" {
+			return "/proxy/" + link.URL.Host + link.URL.RequestURI()
+		}
+		return link.URL.String()
+	}
+	render(t, r)
+
+	expected := `<h1>Title &lt;1&gt;</h1>
+<p>Text &amp; more</p>
+<p><a href="/proxy/example.com/a?x=1&amp;y=2">Link &#34;A&#34;</a></p>
+<p><a href="#">Bad</a></p>
+<ul>
+<li>one</li>
+<li>two</li>
+</ul>
+<blockquote>
+<p>quoted</p>
+</blockquote>
+<pre aria-label="alt">
+  &lt;pre&gt;
+</pre>
+<br>
+<p>last</p>
+`
+	if b.String() != expected {
+		t.Errorf("unexpected HTML:\n%s", b.String())
+	}
+}
+
+func TestMarkdownRenderer(t *testing.T) {
+	var b strings.Builder
+	render(t, NewMarkdownRenderer(&b))
+
+	expected := "# Title \\<1\\>\n" +
+		"\n" +
+		"Text \\& more\n" +
+		"\n" +
+		"[Link \"A\"](<gemini://example.com/a?x=1&y=2>)\n" +
+		"\n" +
+		"[Bad](<javascript:alert(1)>)\n" +
+		"\n" +
+		"- one\n" +
+		"- two\n" +
+		"\n" +
+		"> quoted\n" +
+		"\n" +
+		"```alt\n" +
+		"  <pre>\n" +
+		"```\n" +
+		"\n" +
+		"last\n"
+	if b.String() != expected {
+		t.Errorf("unexpected Markdown:\n%s", b.String())
+	}
+}
+
+func TestRenderersOtherLinesInPreformatted(t *testing.T) {
+	renderers := map[string]func(w io.Writer) Renderer{
+		"HTML":     func(w io.Writer) Renderer { return NewHTMLRenderer(w) },
+		"Markdown": func(w io.Writer) Renderer { return NewMarkdownRenderer(w) },
+		"ANSI":     func(w io.Writer) Renderer { return NewANSIRenderer(w) },
+	}
+	for name, newRenderer := range renderers {
+		var b strings.Builder
+		r := newRenderer(&b)
+		for _, line := range []Line{PreformatToggle{}, Text("x"), ListItem("y"), PreformatToggle{}} {
+			if err := r.WriteLine(line); err != nil {
+				t.Errorf("%s: unexpected error: %v", name, err)
+			}
+		}
+		r.Close()
+		if !strings.Contains(b.String(), "x") || !strings.Contains(b.String(), "y") {
+			t.Errorf("%s: lines in block were not rendered: %q", name, b.String())
+		}
+	}
+}
+
+func TestEscapeMarkdown(t *testing.T) {
+	tests := map[string]string{
+		"*bold* _it_":   `\*bold\* \_it\_`,
+		"- not a list":  `\- not a list`,
+		"1. not a list": `1\. not a list`,
+		"a - b":         "a - b",
+	}
+	for s, expected := range tests {
+		if e := escapeMarkdown(s); e != expected {
+			t.Errorf("expected %q, got %q", expected, e)
+		}
+	}
+}
+
+func TestANSIRenderer(t *testing.T) {
+	var b strings.Builder
+	r := NewANSIRenderer(&b)
+	r.NoColor = true
+	r.Width = 12
+	r.WriteLine(Text("one two three four"))
+	r.WriteLine(ListItem("alpha beta gamma"))
+	r.WriteLine(Quote(" a b c d e f g h"))
+	r.WriteLine(Text("\x1b[31mred\x1b[0m"))
+	r.WriteLine(Text("abcdefghijklmnopq"))
+	r.WriteLine(PreformattedText("no wrapping for this line"))
+	r.Close()
+
+	expected := "one two\nthree four\n" +
+		"• alpha beta\n  gamma\n" +
+		"> a b c d e\n> f g h\n" +
+		"[31mred[0m\n" +
+		"abcdefghijkl\nmnopq\n" +
+		"no wrapping for this line\n"
+	if b.String() != expected {
+		t.Errorf("unexpected output:\n%q", b.String())
+	}
+}
+
+func TestANSIRendererLinkStyle(t *testing.T) {
+	var b strings.Builder
+	r := NewANSIRenderer(&b)
+	r.Width = 9
+	r.WriteLine(Link{RawURL: "/x", Label: "abc def"})
+
+	expected := "=> " + ansiBlue + ansiUnderline + "abc" + ansiReset + "\n" +
+		"   " + ansiBlue + ansiUnderline + "def" + ansiReset + " " + ansiFaint + "/x" + ansiReset + "\n"
+	if b.String() != expected {
+		t.Errorf("unexpected output:\n%q\nexpected:\n%q", b.String(), expected)
+	}
+}
@@ -7,6 +7,5 @@ toolchain go1.24.1
 require (
 	github.com/google/go-cmp v0.6.0
 	golang.org/x/net v0.38.0
+	golang.org/x/text v0.23.0
 )
-
-require golang.org/x/text v0.23.0 // indirect
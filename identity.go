@@ -0,0 +1,233 @@
+package gemini
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultIdentityValidity is how long generated identities are valid for if
+// IdentityOptions.Validity is not set.
+const DefaultIdentityValidity = 365 * 24 * time.Hour
+
+// KeyType is the type of key used for a generated identity.
+type KeyType int
+
+const (
+	// KeyECDSA is an ECDSA key on the P-256 curve.
+	KeyECDSA KeyType = iota
+	// KeyEd25519 is an Ed25519 key.
+	KeyEd25519
+)
+
+// IdentityOptions are the options for generating an identity with
+// NewIdentity.
+type IdentityOptions struct {
+	// CommonName is the name in the cert subject. Gemini servers often show it
+	// to identify the user.
+	CommonName string
+
+	KeyType KeyType
+
+	// Validity is how long the cert is valid for, starting now. If it's 0,
+	// DefaultIdentityValidity is used.
+	Validity time.Duration
+}
+
+// Identity is a client cert and its private key, used to identify to Gemini
+// servers.
+type Identity struct {
+	Cert *x509.Certificate
+	Key  crypto.Signer
+}
+
+// NewIdentity generates a new self-signed client cert.
+func NewIdentity(opts IdentityOptions) (*Identity, error) {
+	var key crypto.Signer
+	var err error
+	switch opts.KeyType {
+	case KeyECDSA:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyEd25519:
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unknown key type %d", opts.KeyType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	validity := opts.Validity
+	if validity == 0 {
+		validity = DefaultIdentityValidity
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: opts.CommonName},
+		NotBefore:    now,
+		NotAfter:     now.Add(validity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cert: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse created cert: %w", err)
+	}
+	return &Identity{Cert: cert, Key: key}, nil
+}
+
+// ParseIdentity parses an identity from PEM encoded blocks, like those
+// returned by Identity.PEM.
+func ParseIdentity(certPEM, keyPEM []byte) (*Identity, error) {
+	tlsCert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse cert/key PEM: %w", err)
+	}
+	key, ok := tlsCert.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", tlsCert.PrivateKey)
+	}
+	return &Identity{Cert: tlsCert.Leaf, Key: key}, nil
+}
+
+// PEM returns the cert and private key as PEM encoded blocks, which can be
+// passed to FetchWithCert. The key is encoded in PKCS #8 form.
+func (id *Identity) PEM() (certPEM, keyPEM []byte, err error) {
+	keyDER, err := x509.MarshalPKCS8PrivateKey(id.Key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal key: %w", err)
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: id.Cert.Raw})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+// TLSCertificate returns the identity in the form used by crypto/tls.
+func (id *Identity) TLSCertificate() tls.Certificate {
+	return tls.Certificate{
+		Certificate: [][]byte{id.Cert.Raw},
+		PrivateKey:  id.Key,
+		Leaf:        id.Cert,
+	}
+}
+
+// IdentityStore maps URL prefixes to identities, so that a Client can use the
+// right identity for every request. This is how identities are usually scoped
+// in Gemini: an identity used for a URL is also used for all the URLs under
+// it. See Client.Identities.
+//
+// The zero value is an empty store. It is safe for concurrent use.
+type IdentityStore struct {
+	mu  sync.RWMutex
+	ids map[string]*Identity
+}
+
+// NewIdentityStore returns an empty IdentityStore.
+func NewIdentityStore() *IdentityStore {
+	return &IdentityStore{ids: make(map[string]*Identity)}
+}
+
+// Add sets the identity to use for the URL prefix and all the URLs under it,
+// for example "gemini://example.com/app/". Queries and fragments are ignored.
+// If the prefix already had an identity it is replaced.
+func (s *IdentityStore) Add(prefix string, id *Identity) error {
+	key, err := identityKey(prefix)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ids == nil {
+		s.ids = make(map[string]*Identity)
+	}
+	s.ids[key] = id
+	return nil
+}
+
+// Remove removes the identity set for exactly the prefix, if there is one.
+func (s *IdentityStore) Remove(prefix string) {
+	key, err := identityKey(prefix)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.ids, key)
+}
+
+// Lookup returns the identity to use for the URL. If multiple prefixes match,
+// the longest one is used.
+func (s *IdentityStore) Lookup(rawURL string) (*Identity, bool) {
+	key, err := identityKey(rawURL)
+	if err != nil {
+		return nil, false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for {
+		if id, ok := s.ids[key]; ok {
+			return id, true
+		}
+		// Go up one path element, trying "/a/b", then "/a/", then "/a"
+		i := strings.LastIndexByte(strings.TrimSuffix(key, "/"), '/')
+		if i == -1 || strings.HasSuffix(key[:i], "/") {
+			// No more path left, just the scheme and host
+			return nil, false
+		}
+		if strings.HasSuffix(key, "/") {
+			key = key[:len(key)-1]
+		} else {
+			key = key[:i+1]
+		}
+	}
+}
+
+// identityKey normalizes a URL for IdentityStore. The host is punycoded and
+// lowercased, the default port is removed, and the path is cleaned.
+func identityKey(rawURL string) (string, error) {
+	pu, err := GetPunycodeURL(rawURL)
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(pu)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid URL %q", rawURL)
+	}
+	scheme := strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port := u.Port(); port != "" && !(scheme == "gemini" && port == "1965") {
+		host += ":" + port
+	}
+	p := u.EscapedPath()
+	if p == "" {
+		p = "/"
+	} else {
+		p = cleanPath(p)
+	}
+	return scheme + "://" + host + p, nil
+}
@@ -0,0 +1,173 @@
+package gemini
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestNewIdentity(t *testing.T) {
+	for _, kt := range []KeyType{KeyECDSA, KeyEd25519} {
+		id, err := NewIdentity(IdentityOptions{CommonName: "alice", KeyType: kt, Validity: time.Hour})
+		if err != nil {
+			t.Fatalf("key type %d: unexpected error: %v", kt, err)
+		}
+		if id.Cert.Subject.CommonName != "alice" {
+			t.Errorf("key type %d: unexpected common name %q", kt, id.Cert.Subject.CommonName)
+		}
+		if d := id.Cert.NotAfter.Sub(id.Cert.NotBefore); d != time.Hour {
+			t.Errorf("key type %d: expected validity of an hour, got %v", kt, d)
+		}
+
+		certPEM, keyPEM, err := id.PEM()
+		if err != nil {
+			t.Fatalf("key type %d: failed to encode PEM: %v", kt, err)
+		}
+		if _, err := tls.X509KeyPair(certPEM, keyPEM); err != nil {
+			t.Errorf("key type %d: PEM is not usable by crypto/tls: %v", kt, err)
+		}
+		parsed, err := ParseIdentity(certPEM, keyPEM)
+		if err != nil {
+			t.Fatalf("key type %d: failed to parse PEM: %v", kt, err)
+		}
+		if !parsed.Cert.Equal(id.Cert) {
+			t.Errorf("key type %d: parsed cert is different", kt)
+		}
+	}
+
+	id, _ := NewIdentity(IdentityOptions{KeyType: KeyEd25519})
+	if _, ok := id.Key.(ed25519.PrivateKey); !ok {
+		t.Errorf("expected Ed25519 key, got %T", id.Key)
+	}
+}
+
+func TestIdentityStore(t *testing.T) {
+	s := NewIdentityStore()
+	root, _ := NewIdentity(IdentityOptions{CommonName: "root"})
+	app, _ := NewIdentity(IdentityOptions{CommonName: "app"})
+	s.Add("gemini://example.com/", root)
+	s.Add("gemini://EXAMPLE.com:1965/app", app)
+
+	tests := []struct {
+		url      string
+		expected *Identity
+	}{
+		{"gemini://example.com", root},
+		{"gemini://example.com/other/page.gmi", root},
+		{"gemini://example.com/app", app},
+		{"gemini://example.com/app/", app},
+		{"gemini://example.com/app/x/y?query", app},
+		{"gemini://example.com/apple", root},
+		{"gemini://example.com/x/../app/y", app},
+		{"gemini://example.org/app", nil},
+		{"gemini://example.com:1966/app", nil},
+	}
+	for _, tc := range tests {
+		id, _ := s.Lookup(tc.url)
+		if id != tc.expected {
+			t.Errorf("%s: expected %v, got %v", tc.url, tc.expected, id)
+		}
+	}
+
+	s.Remove("gemini://example.com/app")
+	if id, _ := s.Lookup("gemini://example.com/app/x"); id != root {
+		t.Errorf("expected root identity after removing app identity")
+	}
+}
+
+// newCommonNameServer starts a server that responds with the common name of
+// the client cert, or asks for a cert if none was sent.
+func newCommonNameServer(t *testing.T) string {
+	return newServer(t, &Server{Handler: HandlerFunc(func(w ResponseWriter, r *Request) {
+		if len(r.TLS.PeerCertificates) == 0 {
+			w.WriteHeader(StatusClientCertificateRequired, "cert required")
+			return
+		}
+		fmt.Fprint(w, r.TLS.PeerCertificates[0].Subject.CommonName)
+	})})
+}
+
+// expectCommonName checks that the server from newCommonNameServer saw the
+// common name.
+func expectCommonName(t *testing.T, res *Response, err error, cn string) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+	if string(body) != cn {
+		t.Errorf("expected server to see %q, got %d %q", cn, res.Status, body)
+	}
+}
+
+func TestIdentityStoreZeroValue(t *testing.T) {
+	var s IdentityStore
+	id, _ := NewIdentity(IdentityOptions{CommonName: "zero"})
+	if err := s.Add("gemini://example.com/", id); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, ok := s.Lookup("gemini://example.com/page"); !ok || got != id {
+		t.Errorf("identity not found")
+	}
+}
+
+func TestClientIdentities(t *testing.T) {
+	addr := newCommonNameServer(t)
+
+	id, _ := NewIdentity(IdentityOptions{CommonName: "alice"})
+	client := &Client{Identities: NewIdentityStore()}
+	client.Identities.Add("gemini://"+addr+"/private/", id)
+
+	res, err := client.Fetch("gemini://" + addr + "/public")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res.Body.Close()
+	if res.Status != StatusClientCertificateRequired {
+		t.Errorf("expected no cert to be sent outside of the prefix, got status %d", res.Status)
+	}
+
+	res, err = client.Fetch("gemini://" + addr + "/private/page")
+	expectCommonName(t, res, err, "alice")
+}
+
+func TestFetchWithTLSCert(t *testing.T) {
+	addr := newCommonNameServer(t)
+	id, _ := NewIdentity(IdentityOptions{CommonName: "bob", KeyType: KeyEd25519})
+
+	res, err := (&Client{}).FetchWithTLSCert("gemini://"+addr+"/", id.TLSCertificate())
+	expectCommonName(t, res, err, "bob")
+}
+
+// opaqueSigner hides the type of the key it wraps, like a key held by an
+// agent would be.
+type opaqueSigner struct {
+	crypto.Signer
+}
+
+func TestClientGetClientCertificate(t *testing.T) {
+	addr := newCommonNameServer(t)
+	id, _ := NewIdentity(IdentityOptions{CommonName: "carol"})
+
+	var requested *url.URL
+	client := &Client{
+		GetClientCertificate: func(u *url.URL, info *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			requested = u
+			return &tls.Certificate{
+				Certificate: [][]byte{id.Cert.Raw},
+				PrivateKey:  opaqueSigner{id.Key},
+			}, nil
+		},
+	}
+	res, err := client.Fetch("gemini://" + addr + "/page")
+	expectCommonName(t, res, err, "carol")
+	if requested == nil || requested.Path != "/page" {
+		t.Errorf("callback was given unexpected URL %v", requested)
+	}
+}
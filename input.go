@@ -0,0 +1,157 @@
+package gemini
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+// DefaultMaxInputs is the max number of times in a row InputFunc is asked for
+// input when handling a single request, if Client.MaxInputs is not set.
+const DefaultMaxInputs = 5
+
+var (
+	// ErrInputTooLong is returned when a URL with user input added to it
+	// would be longer than URLMaxLength.
+	ErrInputTooLong = errors.New("input is too long")
+
+	// ErrNotInput is returned by Client.SubmitInput when the response is not
+	// asking for input.
+	ErrNotInput = errors.New("response is not asking for input")
+
+	// ErrTooManyInputs is returned by Client.Do when the server keeps asking
+	// for input after more than Client.MaxInputs inputs were sent in a row.
+	ErrTooManyInputs = errors.New("too many inputs")
+)
+
+// InputPrompt is a request for input from a server, with status 10 or 11.
+type InputPrompt struct {
+	// URL is the URL that asked for input. The input is sent to it.
+	URL *url.URL
+
+	// Prompt is the text to show the user, from the response meta.
+	Prompt string
+
+	// Sensitive is true for sensitive input, such as passwords, which should
+	// not be echoed to the screen.
+	Sensitive bool
+}
+
+// InputFunc gets input from the user for the prompt. It returns false if the
+// user doesn't provide any, in which case the input response is returned as
+// is. See Client.InputFunc.
+//
+// InputURL can be used to check the input isn't too long before returning it.
+type InputFunc func(prompt InputPrompt) (input string, ok bool)
+
+// InputURL returns the URL to request to submit input to rawURL, which is the
+// URL that asked for input. The input is escaped with QueryEscape and replaces
+// any existing query.
+//
+// If the resulting URL would be longer than URLMaxLength, an error wrapping
+// ErrInputTooLong is returned.
+func InputURL(rawURL, input string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse URL: %w", err)
+	}
+	u.RawQuery = QueryEscape(input)
+	u.ForceQuery = true // Empty input is still input
+	u.Fragment = ""
+	u.RawFragment = ""
+
+	// The length limit applies to what is sent to the server
+	pu, err := GetPunycodeURL(u.String())
+	if err != nil {
+		return "", fmt.Errorf("error when punycoding URL: %w", err)
+	}
+	if len(pu) > URLMaxLength {
+		return "", fmt.Errorf("%w: URL would be %d bytes, the max is %d",
+			ErrInputTooLong, len(pu), URLMaxLength)
+	}
+	return u.String(), nil
+}
+
+// SubmitInput sends input to the URL that asked for it with res. rawURL is
+// that URL. If it's empty, the URL of res.Request is used. The body of res is
+// closed.
+//
+// If res is not asking for input, ErrNotInput is returned. If the input is too
+// long, an error wrapping ErrInputTooLong is returned.
+func (c *Client) SubmitInput(res *Response, rawURL, input string) (*Response, error) {
+	if SimplifyStatus(res.Status) != StatusInput {
+		return nil, ErrNotInput
+	}
+	if res.Body != nil {
+		res.Body.Close()
+	}
+
+	req := &Request{}
+	if res.Request != nil {
+		r := *res.Request
+		req = &r
+	}
+	if rawURL == "" {
+		if req.URL == nil {
+			return nil, ErrNoURL
+		}
+		rawURL = req.URL.String()
+	} else if u, err := url.Parse(rawURL); err != nil {
+		return nil, fmt.Errorf("failed to parse URL: %w", err)
+	} else if req.URL == nil || u.Host != req.URL.Host {
+		// Not the URL of the request, so none of its settings apply
+		req = &Request{ctx: req.ctx}
+	}
+	next, err := inputRequest(req, rawURL, input)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(next)
+}
+
+// handleInput gets input for res with InputFunc, and sends it, for as long as
+// the server asks for more, up to the max number of inputs.
+func (c *Client) handleInput(res *Response) (*Response, error) {
+	max := c.MaxInputs
+	if max <= 0 {
+		max = DefaultMaxInputs
+	}
+	for n := 0; SimplifyStatus(res.Status) == StatusInput; n++ {
+		if n == max {
+			res.Body.Close()
+			return nil, ErrTooManyInputs
+		}
+		req := res.Request
+		prompt := InputPrompt{
+			URL:       req.URL,
+			Prompt:    res.Meta,
+			Sensitive: res.Status == StatusSensitiveInput,
+		}
+		input, ok := c.InputFunc(prompt)
+		if !ok {
+			return res, nil
+		}
+		res.Body.Close()
+
+		next, err := inputRequest(req, req.URL.String(), input)
+		if err != nil {
+			return nil, err
+		}
+		res, err = c.sendFollowingRedirects(next)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// inputRequest returns a copy of req for the input URL.
+func inputRequest(req *Request, rawURL, input string) (*Request, error) {
+	inputURL, err := InputURL(rawURL, input)
+	if err != nil {
+		return nil, err
+	}
+	next := *req
+	next.URL, _ = url.Parse(inputURL)
+	return &next, nil
+}
@@ -0,0 +1,127 @@
+package gemini
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestInputURL(t *testing.T) {
+	u, err := InputURL("gemini://example.com/search?old#frag", "a b/c+d")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if u != "gemini://example.com/search?a%20b%2Fc%2Bd" {
+		t.Errorf("unexpected URL %s", u)
+	}
+
+	u, _ = InputURL("gemini://example.com/search", "")
+	if u != "gemini://example.com/search?" {
+		t.Errorf("unexpected URL for empty input %s", u)
+	}
+
+	// Each space is escaped to 3 bytes
+	_, err = InputURL("gemini://example.com/", strings.Repeat(" ", URLMaxLength/3))
+	if !errors.Is(err, ErrInputTooLong) {
+		t.Errorf("expected ErrInputTooLong, got %v", err)
+	}
+}
+
+// newInputServer starts a server that asks for input with the status until
+// it gets a query, and then responds with the query.
+func newInputServer(t *testing.T, status int) string {
+	return newTestServer(t, func(conn net.Conn) {
+		u, _ := url.Parse(readRequest(conn))
+		if u.RawQuery == "" {
+			fmt.Fprintf(conn, "%d Password?\r\n", status)
+			return
+		}
+		q, _ := QueryUnescape(u.RawQuery)
+		fmt.Fprintf(conn, "20 text/plain\r\n%s", q)
+	})
+}
+
+func TestClientInputFunc(t *testing.T) {
+	addr := newInputServer(t, StatusSensitiveInput)
+
+	var prompt InputPrompt
+	client := &Client{InputFunc: func(p InputPrompt) (string, bool) {
+		prompt = p
+		return "hunter 2", true
+	}}
+	res, err := client.Fetch("gemini://" + addr + "/login")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+	if string(body) != "hunter 2" {
+		t.Errorf("server got unexpected input %q", body)
+	}
+	if !prompt.Sensitive || prompt.Prompt != "Password?" || prompt.URL.Path != "/login" {
+		t.Errorf("unexpected prompt %+v", prompt)
+	}
+}
+
+func TestClientInputFuncDeclined(t *testing.T) {
+	addr := newInputServer(t, StatusInput)
+
+	client := &Client{InputFunc: func(p InputPrompt) (string, bool) {
+		return "", false
+	}}
+	res, err := client.Fetch("gemini://" + addr + "/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res.Body.Close()
+	if res.Status != StatusInput {
+		t.Errorf("expected input response, got %d", res.Status)
+	}
+}
+
+func TestClientInputFuncMaxInputs(t *testing.T) {
+	addr := newTestServer(t, func(conn net.Conn) {
+		readRequest(conn)
+		fmt.Fprint(conn, "10 Again?\r\n")
+	})
+
+	asked := 0
+	client := &Client{MaxInputs: 2, InputFunc: func(p InputPrompt) (string, bool) {
+		asked++
+		return "yes", true
+	}}
+	_, err := client.Fetch("gemini://" + addr + "/")
+	if !errors.Is(err, ErrTooManyInputs) {
+		t.Errorf("expected ErrTooManyInputs, got %v", err)
+	}
+	if asked != 2 {
+		t.Errorf("expected InputFunc to be called 2 times, got %d", asked)
+	}
+}
+
+func TestClientSubmitInput(t *testing.T) {
+	addr := newInputServer(t, StatusInput)
+	client := &Client{}
+
+	res, err := client.Fetch("gemini://" + addr + "/q")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res, err = client.SubmitInput(res, "", "answer")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+	if string(body) != "answer" {
+		t.Errorf("server got unexpected input %q", body)
+	}
+
+	if _, err := client.SubmitInput(res, "", "again"); err != ErrNotInput {
+		t.Errorf("expected ErrNotInput, got %v", err)
+	}
+}
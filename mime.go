@@ -0,0 +1,110 @@
+package gemini
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/transform"
+)
+
+// DefaultMediaType is the MIME type of successful responses with an empty
+// meta string, as defined by the spec.
+const DefaultMediaType = "text/gemini; charset=utf-8"
+
+var (
+	// ErrNotSuccess is returned when trying to get the MIME type of a response
+	// whose status isn't a success status.
+	ErrNotSuccess = errors.New("response status is not success")
+
+	// ErrUnknownCharset is returned by Response.DecodedBody when the charset of
+	// the response is not supported.
+	ErrUnknownCharset = errors.New("unknown charset")
+)
+
+// MediaType is a parsed MIME type, like "text/gemini; lang=en".
+type MediaType struct {
+	Type    string // "text"
+	Subtype string // "gemini"
+	// Params holds the parameters, with lowercased keys. For example "lang".
+	Params map[string]string
+}
+
+// String returns the MIME type without its parameters, for example
+// "text/gemini".
+func (mt MediaType) String() string {
+	return mt.Type + "/" + mt.Subtype
+}
+
+// Charset returns the charset parameter, lowercased. For text types without a
+// charset it returns "utf-8", which the spec says must be assumed. For other
+// types without a charset it returns the empty string.
+func (mt MediaType) Charset() string {
+	if cs, ok := mt.Params["charset"]; ok {
+		return strings.ToLower(cs)
+	}
+	if mt.Type == "text" {
+		return "utf-8"
+	}
+	return ""
+}
+
+// ParseMediaType parses a MIME type like the meta string of a successful
+// response. An empty string is parsed as DefaultMediaType.
+func ParseMediaType(s string) (MediaType, error) {
+	if strings.TrimSpace(s) == "" {
+		s = DefaultMediaType
+	}
+	full, params, err := mime.ParseMediaType(s)
+	if err != nil {
+		return MediaType{}, fmt.Errorf("invalid MIME type %q: %w", s, err)
+	}
+	typ, subtype, ok := strings.Cut(full, "/")
+	if !ok {
+		return MediaType{}, fmt.Errorf("invalid MIME type %q: no subtype", s)
+	}
+	return MediaType{Type: typ, Subtype: subtype, Params: params}, nil
+}
+
+// MediaType returns the parsed MIME type of a successful response, from its
+// meta string. If the meta string is empty, DefaultMediaType is returned.
+func (r *Response) MediaType() (MediaType, error) {
+	if SimplifyStatus(r.Status) != StatusSuccess {
+		return MediaType{}, ErrNotSuccess
+	}
+	return ParseMediaType(r.Meta)
+}
+
+// DecodedBody returns the body of a successful text response, decoded from its
+// charset into UTF-8. If the charset is already UTF-8 or the response is not
+// text, the body is returned as is. Closing the returned body closes the
+// response body.
+//
+// An error wrapping ErrUnknownCharset is returned if the charset is not
+// supported.
+func (r *Response) DecodedBody() (io.ReadCloser, error) {
+	mt, err := r.MediaType()
+	if err != nil {
+		return nil, err
+	}
+	cs := mt.Charset()
+	if mt.Type != "text" || cs == "utf-8" || cs == "utf8" || cs == "us-ascii" {
+		return r.Body, nil
+	}
+	enc, err := htmlindex.Get(cs)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCharset, cs)
+	}
+	return &decodedBody{
+		Reader: transform.NewReader(r.Body, enc.NewDecoder()),
+		Closer: r.Body,
+	}, nil
+}
+
+type decodedBody struct {
+	io.Reader
+	io.Closer
+}
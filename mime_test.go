@@ -0,0 +1,68 @@
+package gemini
+
+import (
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseMediaType(t *testing.T) {
+	tests := []struct {
+		meta     string
+		expected MediaType
+		charset  string
+	}{
+		{"", MediaType{"text", "gemini", map[string]string{"charset": "utf-8"}}, "utf-8"},
+		{"text/gemini; lang=en", MediaType{"text", "gemini", map[string]string{"lang": "en"}}, "utf-8"},
+		{"text/plain; charset=ISO-8859-1", MediaType{"text", "plain", map[string]string{"charset": "ISO-8859-1"}}, "iso-8859-1"},
+		{"image/png", MediaType{"image", "png", map[string]string{}}, ""},
+	}
+	for _, tc := range tests {
+		mt, err := ParseMediaType(tc.meta)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tc.meta, err)
+			continue
+		}
+		if diff := cmp.Diff(tc.expected, mt); diff != "" {
+			t.Errorf("%q: unexpected media type (-want +got):\n%s", tc.meta, diff)
+		}
+		if cs := mt.Charset(); cs != tc.charset {
+			t.Errorf("%q: expected charset %q, got %q", tc.meta, tc.charset, cs)
+		}
+	}
+
+	if _, err := ParseMediaType("text/"); err == nil {
+		t.Errorf("expected error for invalid MIME type")
+	}
+}
+
+func TestResponseMediaTypeNotSuccess(t *testing.T) {
+	res := &Response{Status: StatusNotFound, Meta: "not found"}
+	if _, err := res.MediaType(); !errors.Is(err, ErrNotSuccess) {
+		t.Errorf("expected ErrNotSuccess, got %v", err)
+	}
+}
+
+func TestDecodedBody(t *testing.T) {
+	res := &Response{
+		Status: StatusSuccess,
+		Meta:   "text/plain; charset=iso-8859-1",
+		Body:   ioutil.NopCloser(strings.NewReader("caf\xe9")),
+	}
+	body, err := res.DecodedBody()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b, _ := ioutil.ReadAll(body)
+	if string(b) != "café" {
+		t.Errorf("expected decoded body, got %q", b)
+	}
+
+	res.Meta = "text/plain; charset=x-nonexistent"
+	if _, err := res.DecodedBody(); !errors.Is(err, ErrUnknownCharset) {
+		t.Errorf("expected ErrUnknownCharset, got %v", err)
+	}
+}
@@ -0,0 +1,201 @@
+package gemini
+
+import (
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// NotFound replies to the request with a Not Found response.
+func NotFound(w ResponseWriter, r *Request) {
+	w.WriteHeader(StatusNotFound, "Not found")
+}
+
+// NotFoundHandler returns a Handler that replies to every request with a
+// Not Found response.
+func NotFoundHandler() Handler {
+	return HandlerFunc(NotFound)
+}
+
+// ServeMux is a request multiplexer. It matches the URL of each request
+// against a list of registered patterns and calls the handler of the pattern
+// that matches the URL most closely.
+//
+// Patterns name fixed paths, like "/about.gmi", or subtrees, like "/docs/".
+// A subtree pattern ends in a slash, and matches all paths under it. Longer
+// patterns take precedence over shorter ones, so if there are handlers for
+// both "/docs/" and "/docs/api/", the latter is called for "/docs/api/x".
+// The pattern "/" matches all paths not matched by other patterns.
+//
+// Patterns can optionally start with a hostname, like "example.com/", to only
+// match requests for that host. Those take precedence over patterns without
+// a hostname.
+//
+// Requests for URLs with a scheme other than gemini get a Proxy Request
+// Refused response. Requests for paths containing . or .. elements or
+// repeated slashes are redirected to the cleaned path. Requests for the
+// subtree root without the trailing slash, like "/docs", are redirected to it
+// if there is no handler for the path itself.
+type ServeMux struct {
+	mu    sync.RWMutex
+	m     map[string]muxEntry
+	es    []muxEntry // Subtree entries, longest first
+	hosts bool       // Whether any pattern has a hostname
+}
+
+type muxEntry struct {
+	h       Handler
+	pattern string
+}
+
+// NewServeMux returns a new, empty ServeMux.
+func NewServeMux() *ServeMux {
+	return &ServeMux{}
+}
+
+// Handle registers the handler for the pattern. It panics if the pattern is
+// invalid or already registered.
+func (mux *ServeMux) Handle(pattern string, handler Handler) {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+
+	if pattern == "" {
+		panic("gemini: invalid pattern")
+	}
+	if handler == nil {
+		panic("gemini: nil handler")
+	}
+	if _, exists := mux.m[pattern]; exists {
+		panic("gemini: multiple registrations for " + pattern)
+	}
+
+	if mux.m == nil {
+		mux.m = make(map[string]muxEntry)
+	}
+	e := muxEntry{h: handler, pattern: pattern}
+	mux.m[pattern] = e
+	if pattern[len(pattern)-1] == '/' {
+		mux.es = append(mux.es, e)
+		sort.SliceStable(mux.es, func(i, j int) bool {
+			return len(mux.es[i].pattern) > len(mux.es[j].pattern)
+		})
+	}
+	if pattern[0] != '/' {
+		mux.hosts = true
+	}
+}
+
+// HandleFunc registers the handler function for the pattern.
+func (mux *ServeMux) HandleFunc(pattern string, handler func(ResponseWriter, *Request)) {
+	mux.Handle(pattern, HandlerFunc(handler))
+}
+
+// Handler returns the handler to use for the request, and the pattern that
+// matched. If no pattern matched, a Not Found handler and an empty pattern
+// are returned. If the request needs to be redirected or refused, the
+// returned handler does that.
+func (mux *ServeMux) Handler(r *Request) (h Handler, pattern string) {
+	if r.URL.Scheme != "gemini" {
+		return HandlerFunc(func(w ResponseWriter, r *Request) {
+			w.WriteHeader(StatusProxyRequestRefused, "Proxy request refused")
+		}), ""
+	}
+
+	host := strings.ToLower(r.URL.Hostname())
+	p := r.URL.Path
+	if p == "" {
+		p = "/"
+	}
+	if cp := cleanPath(p); cp != p {
+		return redirectHandler(r.URL, cp), ""
+	}
+
+	mux.mu.RLock()
+	defer mux.mu.RUnlock()
+
+	if mux.shouldRedirect(host, p) {
+		return redirectHandler(r.URL, p+"/"), ""
+	}
+	if h, pattern = mux.match(host, p); h != nil {
+		return h, pattern
+	}
+	return NotFoundHandler(), ""
+}
+
+// ServeGemini dispatches the request to the handler whose pattern matches
+// the request URL most closely.
+func (mux *ServeMux) ServeGemini(w ResponseWriter, r *Request) {
+	h, _ := mux.Handler(r)
+	h.ServeGemini(w, r)
+}
+
+// match finds the handler for the host and path. The caller must hold mux.mu.
+func (mux *ServeMux) match(host, p string) (Handler, string) {
+	if mux.hosts {
+		if h, pattern := mux.matchPath(host + p); h != nil {
+			return h, pattern
+		}
+	}
+	return mux.matchPath(p)
+}
+
+// shouldRedirect reports whether the path should be redirected to the subtree
+// root, because only the subtree is registered. The caller must hold mux.mu.
+func (mux *ServeMux) shouldRedirect(host, p string) bool {
+	if strings.HasSuffix(p, "/") {
+		return false
+	}
+	keys := []string{p}
+	if mux.hosts {
+		keys = append(keys, host+p)
+	}
+	for _, k := range keys {
+		if _, exists := mux.m[k]; exists {
+			return false
+		}
+	}
+	for _, k := range keys {
+		if _, exists := mux.m[k+"/"]; exists {
+			return true
+		}
+	}
+	return false
+}
+
+func (mux *ServeMux) matchPath(p string) (Handler, string) {
+	if e, ok := mux.m[p]; ok {
+		return e.h, e.pattern
+	}
+	for _, e := range mux.es {
+		if strings.HasPrefix(p, e.pattern) {
+			return e.h, e.pattern
+		}
+	}
+	return nil, ""
+}
+
+// cleanPath returns the canonical path for p, removing . and .. elements
+// and repeated slashes, but keeping a trailing slash.
+func cleanPath(p string) string {
+	if p[0] != '/' {
+		p = "/" + p
+	}
+	np := path.Clean(p)
+	if p[len(p)-1] == '/' && np != "/" {
+		np += "/"
+	}
+	return np
+}
+
+// redirectHandler returns a handler that permanently redirects to u with the
+// path replaced.
+func redirectHandler(u *url.URL, p string) Handler {
+	target := *u
+	target.Path = p
+	target.RawPath = ""
+	return HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.WriteHeader(StatusRedirectPermanent, target.String())
+	})
+}
@@ -0,0 +1,74 @@
+package gemini
+
+import (
+	"net/url"
+	"testing"
+)
+
+// recorder is a ResponseWriter that records the header.
+type recorder struct {
+	status int
+	meta   string
+}
+
+func (rec *recorder) WriteHeader(status int, meta string) error {
+	rec.status, rec.meta = status, meta
+	return nil
+}
+
+func (rec *recorder) Write(p []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = StatusSuccess
+	}
+	return len(p), nil
+}
+
+func TestServeMux(t *testing.T) {
+	mux := NewServeMux()
+	handler := func(pattern string) Handler {
+		return HandlerFunc(func(w ResponseWriter, r *Request) {
+			w.WriteHeader(StatusSuccess, pattern)
+		})
+	}
+	for _, pattern := range []string{"/", "/about.gmi", "/docs/", "/docs/api/", "example.com/docs/"} {
+		mux.Handle(pattern, handler(pattern))
+	}
+
+	tests := []struct {
+		url    string
+		status int
+		meta   string
+	}{
+		{"gemini://example.org", StatusSuccess, "/"},
+		{"gemini://example.org/other", StatusSuccess, "/"},
+		{"gemini://example.org/about.gmi", StatusSuccess, "/about.gmi"},
+		{"gemini://example.org/docs/", StatusSuccess, "/docs/"},
+		{"gemini://example.org/docs/x", StatusSuccess, "/docs/"},
+		{"gemini://example.org/docs/api/x", StatusSuccess, "/docs/api/"},
+		{"gemini://example.com/docs/api/x", StatusSuccess, "example.com/docs/"},
+		{"gemini://example.org/docs", StatusRedirectPermanent, "gemini://example.org/docs/"},
+		{"gemini://example.org/docs/../about.gmi", StatusRedirectPermanent, "gemini://example.org/about.gmi"},
+		{"gemini://example.org//about.gmi", StatusRedirectPermanent, "gemini://example.org/about.gmi"},
+		{"https://example.org/", StatusProxyRequestRefused, "Proxy request refused"},
+	}
+	for _, tc := range tests {
+		u, _ := url.Parse(tc.url)
+		rec := &recorder{}
+		mux.ServeGemini(rec, &Request{URL: u})
+		if rec.status != tc.status || rec.meta != tc.meta {
+			t.Errorf("%s: expected %d %s, got %d %s", tc.url, tc.status, tc.meta, rec.status, rec.meta)
+		}
+	}
+}
+
+func TestServeMuxNotFound(t *testing.T) {
+	mux := NewServeMux()
+	mux.HandleFunc("/a", func(w ResponseWriter, r *Request) {})
+
+	u, _ := url.Parse("gemini://example.org/b")
+	rec := &recorder{}
+	mux.ServeGemini(rec, &Request{URL: u})
+	if rec.status != StatusNotFound {
+		t.Errorf("expected not found, got %d", rec.status)
+	}
+}
@@ -0,0 +1,108 @@
+package gemini
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// SOCKS5Proxy returns a ProxyFunc that connects through the SOCKS5 proxy at
+// addr, for example "127.0.0.1:9050" for Tor. If username is not empty, it's
+// used with password to authenticate with the proxy.
+//
+// Hostnames are resolved by the proxy, so they are not leaked to the local
+// DNS resolver, and .onion addresses can be reached through Tor.
+//
+// The dialer's timeout covers connecting to the proxy and the SOCKS handshake.
+func SOCKS5Proxy(addr, username, password string) ProxyFunc {
+	var auth *proxy.Auth
+	if username != "" {
+		auth = &proxy.Auth{User: username, Password: password}
+	}
+	return func(dialer *net.Dialer, address string) (net.Conn, error) {
+		d, err := proxy.SOCKS5("tcp", addr, auth, dialer)
+		if err != nil {
+			return nil, err
+		}
+		ctx, cancel := dialerContext(dialer)
+		defer cancel()
+		return d.(proxy.ContextDialer).DialContext(ctx, "tcp", address)
+	}
+}
+
+// HTTPConnectProxy returns a ProxyFunc that connects through the HTTP proxy
+// at addr, using the CONNECT method. If username is not empty, it's used with
+// password to authenticate with the proxy, using basic auth.
+//
+// Hostnames are resolved by the proxy. The dialer's timeout covers connecting
+// to the proxy and getting its response.
+func HTTPConnectProxy(addr, username, password string) ProxyFunc {
+	return func(dialer *net.Dialer, address string) (net.Conn, error) {
+		ctx, cancel := dialerContext(dialer)
+		defer cancel()
+
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		if deadline, ok := ctx.Deadline(); ok {
+			conn.SetDeadline(deadline)
+		}
+
+		req := "CONNECT " + address + " HTTP/1.1\r\nHost: " + address + "\r\n"
+		if username != "" {
+			creds := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+			req += "Proxy-Authorization: Basic " + creds + "\r\n"
+		}
+		if _, err := conn.Write([]byte(req + "\r\n")); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to send CONNECT request to proxy: %w", err)
+		}
+
+		br := bufio.NewReader(conn)
+		res, err := http.ReadResponse(br, &http.Request{Method: http.MethodConnect})
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to read CONNECT response from proxy: %w", err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			conn.Close()
+			return nil, fmt.Errorf("proxy refused CONNECT: %s", res.Status)
+		}
+
+		conn.SetDeadline(time.Time{})
+		if br.Buffered() > 0 {
+			// The proxy sent data past the response, don't lose it
+			return &bufferedConn{Conn: conn, r: br}, nil
+		}
+		return conn, nil
+	}
+}
+
+// dialerContext returns a context that times out after the dialer's timeout,
+// if it has one. A ProxyFunc doesn't get the request context, so that's the
+// only limit on the dial itself. Client.connect stops waiting for the dial
+// when the request context is done.
+func dialerContext(dialer *net.Dialer) (context.Context, context.CancelFunc) {
+	if dialer.Timeout == 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), dialer.Timeout)
+}
+
+// bufferedConn is a net.Conn that reads from a buffered reader first.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
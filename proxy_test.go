@@ -0,0 +1,201 @@
+package gemini
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newProxyListener starts a listener on localhost that calls handler for
+// every connection, and returns its address.
+func newProxyListener(t *testing.T, handler func(conn net.Conn)) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				handler(conn)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// pipe connects conn to the target address, and copies data between them.
+func pipe(conn net.Conn, target string) {
+	tc, err := net.Dial("tcp", target)
+	if err != nil {
+		return
+	}
+	defer tc.Close()
+	go io.Copy(tc, conn)
+	io.Copy(conn, tc)
+}
+
+// socks5Server is a minimal SOCKS5 server for tests, that only supports
+// CONNECT to domain names. It records the last host it was asked for.
+func socks5Server(t *testing.T, username, password string, hosts chan<- string) string {
+	return newProxyListener(t, func(conn net.Conn) {
+		buf := make([]byte, 256)
+		// Greeting: version, number of methods, methods
+		if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+			return
+		}
+		if _, err := io.ReadFull(conn, buf[:buf[1]]); err != nil {
+			return
+		}
+		if username == "" {
+			conn.Write([]byte{5, 0})
+		} else {
+			conn.Write([]byte{5, 2})
+			// Version, username, password
+			io.ReadFull(conn, buf[:2])
+			user := make([]byte, buf[1])
+			io.ReadFull(conn, user)
+			io.ReadFull(conn, buf[:1])
+			pass := make([]byte, buf[0])
+			io.ReadFull(conn, pass)
+			if string(user) != username || string(pass) != password {
+				conn.Write([]byte{1, 1})
+				return
+			}
+			conn.Write([]byte{1, 0})
+		}
+
+		// Request: version, command, reserved, address type
+		if _, err := io.ReadFull(conn, buf[:4]); err != nil || buf[3] != 3 {
+			conn.Write([]byte{5, 8, 0, 1, 0, 0, 0, 0, 0, 0})
+			return
+		}
+		io.ReadFull(conn, buf[:1])
+		host := make([]byte, buf[0])
+		io.ReadFull(conn, host)
+		io.ReadFull(conn, buf[:2])
+		port := binary.BigEndian.Uint16(buf[:2])
+		hosts <- string(host)
+
+		conn.Write([]byte{5, 0, 0, 1, 127, 0, 0, 1, 0, 0})
+		pipe(conn, net.JoinHostPort("127.0.0.1", strconv.Itoa(int(port))))
+	})
+}
+
+func newSuccessServer(t *testing.T) string {
+	return newTestServer(t, func(conn net.Conn) {
+		readRequest(conn)
+		conn.Write([]byte("20 text/plain\r\n"))
+	})
+}
+
+func TestSOCKS5Proxy(t *testing.T) {
+	_, port, _ := net.SplitHostPort(newSuccessServer(t))
+	hosts := make(chan string, 1)
+	proxyAddr := socks5Server(t, "user", "pass", hosts)
+
+	client := &Client{Proxy: SOCKS5Proxy(proxyAddr, "user", "pass")}
+	res, err := client.Fetch("gemini://localhost:" + port + "/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res.Body.Close()
+	if res.Status != StatusSuccess {
+		t.Errorf("expected success, got %d", res.Status)
+	}
+	if host := <-hosts; host != "localhost" {
+		t.Errorf("expected the proxy to resolve localhost, got %q", host)
+	}
+
+	client.Proxy = SOCKS5Proxy(proxyAddr, "user", "wrong")
+	if _, err := client.Fetch("gemini://localhost:" + port + "/"); err == nil {
+		t.Errorf("expected error with wrong password")
+	}
+}
+
+func TestSOCKS5ProxyTimeout(t *testing.T) {
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+	proxyAddr := newProxyListener(t, func(conn net.Conn) {
+		<-done // Never respond
+	})
+
+	client := &Client{
+		ConnectTimeout: 50 * time.Millisecond,
+		Proxy:          SOCKS5Proxy(proxyAddr, "", ""),
+	}
+	start := time.Now()
+	if _, err := client.Fetch("gemini://localhost/"); err == nil {
+		t.Errorf("expected error")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("dialer timeout was not honoured")
+	}
+}
+
+func TestProxyContextCanceled(t *testing.T) {
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+	proxyAddr := newProxyListener(t, func(conn net.Conn) {
+		<-done // Never respond
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	client := &Client{Proxy: SOCKS5Proxy(proxyAddr, "", "")}
+	start := time.Now()
+	if _, err := client.FetchContext(ctx, "gemini://localhost/"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context deadline error, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("request context was not honoured")
+	}
+}
+
+func TestHTTPConnectProxy(t *testing.T) {
+	_, port, _ := net.SplitHostPort(newSuccessServer(t))
+	proxyAddr := newProxyListener(t, func(conn net.Conn) {
+		req, err := http.ReadRequest(bufio.NewReader(conn))
+		if err != nil || req.Method != http.MethodConnect {
+			return
+		}
+		if req.Header.Get("Proxy-Authorization") != "Basic "+base64.StdEncoding.EncodeToString([]byte("user:pass")) {
+			conn.Write([]byte("HTTP/1.1 407 Proxy Authentication Required\r\n\r\n"))
+			return
+		}
+		_, targetPort, _ := net.SplitHostPort(req.Host)
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		pipe(conn, net.JoinHostPort("127.0.0.1", targetPort))
+	})
+
+	client := &Client{Proxy: HTTPConnectProxy(proxyAddr, "user", "pass")}
+	res, err := client.Fetch("gemini://localhost:" + port + "/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res.Body.Close()
+	if res.Status != StatusSuccess {
+		t.Errorf("expected success, got %d", res.Status)
+	}
+
+	client.Proxy = HTTPConnectProxy(proxyAddr, "", "")
+	_, err = client.Fetch("gemini://localhost:" + port + "/")
+	if err == nil || !strings.Contains(err.Error(), "407") {
+		t.Errorf("expected proxy refusal, got %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+package gemini
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+// DefaultMaxRedirects is the max number of redirects followed in a row if
+// RedirectPolicy.MaxRedirects is not set. The Gemini spec says clients should
+// limit the number of redirects they follow to 5.
+const DefaultMaxRedirects = 5
+
+var (
+	// ErrUseLastResponse can be returned by RedirectPolicy.CheckRedirect to stop
+	// following redirects without an error. The last redirect response is
+	// returned, with its body still open.
+	ErrUseLastResponse = errors.New("use last response")
+
+	// ErrTooManyRedirects means more than RedirectPolicy.MaxRedirects
+	// redirects were made in a row.
+	ErrTooManyRedirects = errors.New("too many redirects")
+
+	// ErrRedirectLoop means a redirect was to a URL already redirected from.
+	ErrRedirectLoop = errors.New("redirect loop")
+
+	// ErrCrossHostRedirect means a redirect was to a different host, and
+	// RedirectPolicy.NoCrossHost is set.
+	ErrCrossHostRedirect = errors.New("redirect to a different host")
+
+	// ErrCrossSchemeRedirect means a redirect was to a scheme other than
+	// gemini, and RedirectPolicy.AllowCrossScheme is not set.
+	ErrCrossSchemeRedirect = errors.New("redirect to a different scheme")
+)
+
+// RedirectError is returned when a redirect is not followed because it
+// violates the RedirectPolicy, or because its URL is invalid.
+type RedirectError struct {
+	// URL is the URL being redirected to, as given by the server.
+	URL string
+	// Via holds the URLs that were redirected from, in order.
+	Via []string
+	Err error
+}
+
+func (e *RedirectError) Error() string {
+	return fmt.Sprintf("redirect to %s: %v", e.URL, e.Err)
+}
+
+func (e *RedirectError) Unwrap() error {
+	return e.Err
+}
+
+// RedirectPolicy controls how a Client follows redirects.
+// The zero value follows up to DefaultMaxRedirects redirects, to any host,
+// as long as the scheme stays gemini.
+//
+// The client cert is only sent to the same host it was provided for, it is
+// not sent after a redirect to a different host.
+type RedirectPolicy struct {
+	// MaxRedirects is the max number of redirects to follow in a row.
+	// If it's 0, DefaultMaxRedirects is used.
+	MaxRedirects int
+
+	// NoCrossHost refuses redirects to a different host.
+	NoCrossHost bool
+
+	// AllowCrossScheme allows redirects to schemes other than gemini. They are
+	// refused by default, as recommended by the spec. Note the request for the
+	// new URL is still made over Gemini, so this is only useful with a host
+	// that proxies other schemes.
+	AllowCrossScheme bool
+
+	// CheckRedirect, if set, is called before following each redirect, after
+	// the other checks have passed. target is the URL being redirected to, and
+	// via holds the URLs that were redirected from, oldest first.
+	//
+	// Returning a non-nil error stops the redirect. If the error is
+	// ErrUseLastResponse then the redirect response is returned, otherwise the
+	// error is returned wrapped in a *RedirectError.
+	CheckRedirect func(target *url.URL, via []*url.URL) error
+}
+
+// check returns an error if the redirect to target shouldn't be followed.
+func (p *RedirectPolicy) check(target *url.URL, via []*url.URL) error {
+	for _, u := range via {
+		if u.String() == target.String() {
+			return ErrRedirectLoop
+		}
+	}
+	max := p.MaxRedirects
+	if max == 0 {
+		max = DefaultMaxRedirects
+	}
+	if len(via) > max {
+		return ErrTooManyRedirects
+	}
+	last := via[len(via)-1]
+	if target.Scheme != "gemini" && !p.AllowCrossScheme {
+		return ErrCrossSchemeRedirect
+	}
+	if target.Host != last.Host && p.NoCrossHost {
+		return ErrCrossHostRedirect
+	}
+	if p.CheckRedirect != nil {
+		return p.CheckRedirect(target, via)
+	}
+	return nil
+}
+
+// followRedirects follows redirects starting from res, which is the response
+// for req.
+func (c *Client) followRedirects(res *Response, req *Request) (*Response, error) {
+	// If the host isn't the one from the URL, all requests are being sent
+	// to a proxy and that shouldn't change
+	proxied := false
+	if req.Host != "" {
+		fh, err := fullHost(req.Host)
+		urlHost, urlErr := fullHost(getHost(req.URL))
+		proxied = err != nil || urlErr != nil || fh != urlHost
+	}
+
+	current := req
+	var via []*url.URL
+	for SimplifyStatus(res.Status) == StatusRedirect {
+		via = append(via, current.URL)
+		redirects := urlStrings(via)
+
+		target, err := current.URL.Parse(res.Meta)
+		if err != nil {
+			res.Body.Close()
+			return nil, &RedirectError{URL: res.Meta, Via: redirects, Err: err}
+		}
+		if err := c.Redirects.check(target, via); err != nil {
+			if err == ErrUseLastResponse {
+				res.Redirects = redirects[:len(redirects)-1]
+				return res, nil
+			}
+			res.Body.Close()
+			return nil, &RedirectError{URL: res.Meta, Via: redirects, Err: err}
+		}
+		res.Body.Close()
+
+		next := *current
+		next.URL = target
+		if !proxied {
+			next.Host = ""
+		}
+		if target.Host != current.URL.Host {
+			// Don't leak the client cert to other hosts
+			next.Certificate = nil
+		}
+		res, err = c.send(&next)
+		if err != nil {
+			return nil, err
+		}
+		current = &next
+	}
+	if len(via) > 0 {
+		res.Redirects = urlStrings(via)
+	}
+	return res, nil
+}
+
+func urlStrings(urls []*url.URL) []string {
+	ss := make([]string, len(urls))
+	for i := range urls {
+		ss[i] = urls[i].String()
+	}
+	return ss
+}
@@ -0,0 +1,151 @@
+package gemini
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// newRedirectServer starts a test server that responds to paths in the
+// redirects map with a redirect to the mapped URL, and to all other paths
+// with a success response.
+func newRedirectServer(t *testing.T, redirects map[string]string) string {
+	return newTestServer(t, func(conn net.Conn) {
+		u, _ := url.Parse(readRequest(conn))
+		if target, ok := redirects[u.Path]; ok {
+			fmt.Fprintf(conn, "30 %s\r\n", target)
+			return
+		}
+		fmt.Fprintf(conn, "20 text/plain\r\n%s", u.Path)
+	})
+}
+
+func TestRedirects(t *testing.T) {
+	addr := newRedirectServer(t, map[string]string{
+		"/a": "/b",
+		"/b": "c",
+	})
+	client := &Client{Redirects: &RedirectPolicy{}}
+
+	res, err := client.Fetch("gemini://" + addr + "/a")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer res.Body.Close()
+	if res.Status != StatusSuccess {
+		t.Fatalf("expected success, got status %d", res.Status)
+	}
+	expected := []string{"gemini://" + addr + "/a", "gemini://" + addr + "/b"}
+	if strings.Join(res.Redirects, " ") != strings.Join(expected, " ") {
+		t.Errorf("expected redirect chain %v, got %v", expected, res.Redirects)
+	}
+}
+
+func TestRedirectsIDNHost(t *testing.T) {
+	var hosts []string
+	client := &Client{
+		Redirects: &RedirectPolicy{},
+		Transport: RoundTripperFunc(func(req *Request) (*Response, error) {
+			hosts = append(hosts, req.Host)
+			if req.URL.Host == "café.example" {
+				return &Response{Status: StatusRedirect, Meta: "gemini://other.example/",
+					Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+			}
+			return &Response{Status: StatusSuccess, Meta: "text/gemini",
+				Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+		}),
+	}
+
+	res, err := client.Fetch("gemini://café.example/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res.Body.Close()
+	if len(hosts) != 2 || hosts[1] != "" {
+		t.Errorf("redirect was sent to the original host: %q", hosts)
+	}
+
+	// Requests with a host that differs after punycoding are still proxied
+	hosts = nil
+	res, err = client.FetchWithHost("proxy.example", "gemini://café.example/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res.Body.Close()
+	if len(hosts) != 2 || hosts[1] != "proxy.example" {
+		t.Errorf("proxied redirect wasn't sent to the proxy: %q", hosts)
+	}
+}
+
+func TestRedirectsNotFollowedByDefault(t *testing.T) {
+	addr := newRedirectServer(t, map[string]string{"/a": "/b"})
+
+	res, err := (&Client{}).Fetch("gemini://" + addr + "/a")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer res.Body.Close()
+	if res.Status != StatusRedirect || res.Meta != "/b" {
+		t.Errorf("expected raw redirect response, got %d %s", res.Status, res.Meta)
+	}
+}
+
+func TestRedirectsRefused(t *testing.T) {
+	addr := newRedirectServer(t, map[string]string{
+		"/loop1":  "/loop2",
+		"/loop2":  "/loop1",
+		"/https":  "https://example.com/",
+		"/other":  "gemini://example.com/",
+		"/chain1": "/chain2",
+		"/chain2": "/chain3",
+		"/chain3": "/chain4",
+	})
+
+	tests := []struct {
+		path     string
+		policy   RedirectPolicy
+		expected error
+	}{
+		{"/loop1", RedirectPolicy{}, ErrRedirectLoop},
+		{"/https", RedirectPolicy{}, ErrCrossSchemeRedirect},
+		{"/other", RedirectPolicy{NoCrossHost: true}, ErrCrossHostRedirect},
+		{"/chain1", RedirectPolicy{MaxRedirects: 2}, ErrTooManyRedirects},
+	}
+
+	for _, tc := range tests {
+		policy := tc.policy
+		_, err := (&Client{Redirects: &policy}).Fetch("gemini://" + addr + tc.path)
+		var redirErr *RedirectError
+		if !errors.As(err, &redirErr) || !errors.Is(err, tc.expected) {
+			t.Errorf("%s: expected %v, got %v", tc.path, tc.expected, err)
+		}
+	}
+}
+
+func TestRedirectsCheckRedirect(t *testing.T) {
+	addr := newRedirectServer(t, map[string]string{"/a": "/b", "/b": "/c"})
+	client := &Client{Redirects: &RedirectPolicy{
+		CheckRedirect: func(target *url.URL, via []*url.URL) error {
+			if target.Path == "/c" {
+				return ErrUseLastResponse
+			}
+			return nil
+		},
+	}}
+
+	res, err := client.Fetch("gemini://" + addr + "/a")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer res.Body.Close()
+	if res.Status != StatusRedirect || res.Meta != "/c" {
+		t.Errorf("expected last redirect response, got %d %s", res.Status, res.Meta)
+	}
+	if len(res.Redirects) != 1 {
+		t.Errorf("expected one redirect in chain, got %v", res.Redirects)
+	}
+}
@@ -0,0 +1,91 @@
+package gemini
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Request is a Gemini request, either one to be sent by a Client, or one
+// received by a Server.
+//
+// Some fields are only used by one side. They are documented as such.
+type Request struct {
+	// URL is the requested URL.
+	URL *url.URL
+
+	// Host is the server to connect to, as "host:port". If the port is
+	// missing, 1965 is assumed. If Host is empty, the host from URL is used.
+	// Setting it to a different host than the one in URL can be used for
+	// Gemini proxying.
+	//
+	// Only used by Client.
+	Host string
+
+	// Certificate is the client cert to send, if any. If it's nil, the
+	// Client's Identities and GetClientCertificate are used instead.
+	//
+	// Only used by Client.
+	Certificate *tls.Certificate
+
+	// ConnectTimeout, ReadTimeout and IdleTimeout override the timeouts of the
+	// same name on the Client, for this request only. They are ignored if
+	// they're 0. A negative IdleTimeout disables the Client's one.
+	//
+	// Only used by Client.
+	ConnectTimeout time.Duration
+	ReadTimeout    time.Duration
+	IdleTimeout    time.Duration
+
+	// MaxBodySize overrides Client.MaxBodySize for this request, if it's not
+	// 0. A negative value means there is no limit.
+	//
+	// Only used by Client.
+	MaxBodySize int64
+
+	// RemoteAddr is the network address of the client that sent the request.
+	//
+	// Only set by Server.
+	RemoteAddr string
+
+	// TLS is the state of the TLS connection the request was received on.
+	// The client cert, if the client sent one, is TLS.PeerCertificates[0].
+	//
+	// Only set by Server.
+	TLS *tls.ConnectionState
+
+	ctx context.Context
+}
+
+// NewRequest returns a new Request for the URL, to be sent by a Client.
+func NewRequest(rawURL string) (*Request, error) {
+	return NewRequestWithContext(context.Background(), rawURL)
+}
+
+// NewRequestWithContext is like NewRequest, but the request uses the provided
+// context. See Client.FetchContext for how the context is used.
+func NewRequestWithContext(ctx context.Context, rawURL string) (*Request, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse URL: %w", err)
+	}
+	return &Request{URL: u, ctx: ctx}, nil
+}
+
+// Context returns the request's context. For requests received by a Server,
+// it is canceled when the server is closed.
+func (r *Request) Context() context.Context {
+	if r.ctx != nil {
+		return r.ctx
+	}
+	return context.Background()
+}
+
+// WithContext returns a shallow copy of r with its context changed to ctx.
+func (r *Request) WithContext(ctx context.Context) *Request {
+	r2 := *r
+	r2.ctx = ctx
+	return &r2
+}
@@ -0,0 +1,69 @@
+package gemini
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestNewRequest(t *testing.T) {
+	req, err := NewRequest("gemini://example.com/path")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if req.URL.Host != "example.com" || req.Context() != context.Background() {
+		t.Errorf("unexpected request %+v", req)
+	}
+	if _, err := NewRequest("gemini://example.com/%zz"); err == nil {
+		t.Errorf("expected error for invalid URL")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req2 := req.WithContext(ctx)
+	if req2.Context() != ctx || req.Context() == ctx {
+		t.Errorf("WithContext should only change the context of the copy")
+	}
+}
+
+func TestClientDoHost(t *testing.T) {
+	addr := newTestServer(t, func(conn net.Conn) {
+		fmt.Fprintf(conn, "20 text/plain\r\n%s", readRequest(conn))
+	})
+
+	// The URL host doesn't exist, the request is sent to Host instead
+	req, _ := NewRequest("gemini://example.invalid/path")
+	req.Host = addr
+	res, err := (&Client{NoHostnameCheck: true}).Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+	if string(body) != "gemini://example.invalid/path" {
+		t.Errorf("server got unexpected request %q", body)
+	}
+}
+
+func TestClientDoReadTimeout(t *testing.T) {
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+	addr := newTestServer(t, func(conn net.Conn) {
+		readRequest(conn)
+		<-done // Never respond
+	})
+
+	req, _ := NewRequest("gemini://" + addr + "/")
+	req.ReadTimeout = 50 * time.Millisecond
+	start := time.Now()
+	_, err := (&Client{}).Do(req)
+	if err == nil {
+		t.Fatalf("expected timeout error")
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("request timeout was not used, took %v", d)
+	}
+}
@@ -0,0 +1,149 @@
+package gemini
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Defaults used by RetryPolicy for fields that are not set.
+const (
+	DefaultMaxAttempts    = 3
+	DefaultRetryBaseDelay = time.Second
+	DefaultRetryMaxDelay  = 30 * time.Second
+)
+
+// RetryPolicy controls how a Client retries requests that failed temporarily.
+// The zero value uses the defaults above.
+//
+// Responses with StatusSlowDown are retried after the number of seconds given
+// in the meta string. Responses with StatusTemporaryFailure and
+// StatusUnavailable, and network errors, are retried after an exponentially
+// increasing delay with random jitter. Waiting stops early if the request's
+// context is canceled.
+//
+// If all attempts fail, the last response or error is returned.
+type RetryPolicy struct {
+	// MaxAttempts is the max number of times a request is made, including the
+	// first time. If it's 0, DefaultMaxAttempts is used.
+	MaxAttempts int
+
+	// BaseDelay is the delay before the first retry, which doubles for every
+	// following retry. If it's 0, DefaultRetryBaseDelay is used.
+	BaseDelay time.Duration
+
+	// MaxDelay is the max delay between attempts. If a server asks to slow
+	// down for longer than that, its response is returned instead of waiting.
+	// If it's 0, DefaultRetryMaxDelay is used.
+	MaxDelay time.Duration
+
+	// NoNetworkErrors disables retrying requests that failed because of
+	// network errors, such as a refused or reset connection, or a timeout.
+	NoNetworkErrors bool
+}
+
+func (p *RetryPolicy) maxAttempts() int {
+	if p.MaxAttempts <= 0 {
+		return DefaultMaxAttempts
+	}
+	return p.MaxAttempts
+}
+
+func (p *RetryPolicy) maxDelay() time.Duration {
+	if p.MaxDelay <= 0 {
+		return DefaultRetryMaxDelay
+	}
+	return p.MaxDelay
+}
+
+// backoff returns the delay before the retry with the given number, starting
+// at 0, with jitter so that clients don't all retry at once.
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	d := p.BaseDelay
+	if d <= 0 {
+		d = DefaultRetryBaseDelay
+	}
+	for i := 0; i < retry && d < p.maxDelay(); i++ {
+		d *= 2
+	}
+	if d > p.maxDelay() {
+		d = p.maxDelay()
+	}
+	// Somewhere between half and all of the delay
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// delay returns how long to wait before retrying a request that got res and
+// err, and whether it should be retried at all.
+func (p *RetryPolicy) delay(retry int, res *Response, err error) (time.Duration, bool) {
+	if err != nil {
+		if p.NoNetworkErrors || !isNetworkError(err) {
+			return 0, false
+		}
+		return p.backoff(retry), true
+	}
+
+	switch res.Status {
+	case StatusSlowDown:
+		secs, err := strconv.Atoi(strings.TrimSpace(res.Meta))
+		if err != nil || secs < 0 {
+			// Invalid meta, still slow down
+			return p.backoff(retry), true
+		}
+		d := time.Duration(secs) * time.Second
+		if d > p.maxDelay() {
+			return 0, false
+		}
+		return d, true
+	case StatusTemporaryFailure, StatusUnavailable:
+		return p.backoff(retry), true
+	}
+	return 0, false
+}
+
+// isNetworkError reports whether err was caused by the network or the server
+// going away, rather than something that would fail again, like an invalid
+// cert or header.
+func isNetworkError(err error) bool {
+	var certErr *CertError
+	var headerErr *HeaderError
+	if errors.As(err, &certErr) || errors.As(err, &headerErr) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// sendWithRetries sends the request using send, retrying according to the
+// client's RetryPolicy.
+func (c *Client) sendWithRetries(req *Request, send func(*Request) (*Response, error)) (*Response, error) {
+	ctx := req.Context()
+	p := c.Retry
+	for attempt := 1; ; attempt++ {
+		res, err := send(req)
+		// Timeouts of a single attempt, such as ConnectTimeout, can be retried,
+		// but not the request being canceled or running out of time.
+		if ctx.Err() != nil || attempt >= p.maxAttempts() {
+			return res, err
+		}
+		d, retry := p.delay(attempt-1, res, err)
+		if !retry {
+			return res, err
+		}
+		if res != nil {
+			res.Body.Close()
+		}
+
+		t := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package gemini
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scriptedTransport returns a transport that replies with the given statuses
+// and metas in order, counting the attempts and the closed bodies.
+func scriptedTransport(attempts, closed *int, replies ...[2]string) RoundTripper {
+	return RoundTripperFunc(func(req *Request) (*Response, error) {
+		reply := replies[len(replies)-1]
+		if *attempts < len(replies) {
+			reply = replies[*attempts]
+		}
+		*attempts++
+		status, _ := strconv.Atoi(reply[0])
+		return &Response{
+			Status: status,
+			Meta:   reply[1],
+			Body:   closeCounter{strings.NewReader(""), closed},
+		}, nil
+	})
+}
+
+type closeCounter struct {
+	io.Reader
+	n *int
+}
+
+func (c closeCounter) Close() error {
+	*c.n++
+	return nil
+}
+
+func TestRetry(t *testing.T) {
+	var attempts, closed int
+	client := &Client{
+		Retry: &RetryPolicy{BaseDelay: time.Millisecond},
+		Transport: scriptedTransport(&attempts, &closed,
+			[2]string{"44", "0"}, [2]string{"41", "Down"}, [2]string{"20", "text/gemini"}),
+	}
+	res, err := client.Fetch("gemini://example.invalid/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.Status != StatusSuccess {
+		t.Errorf("expected success, got %d", res.Status)
+	}
+	if attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", attempts)
+	}
+	if closed != 2 {
+		t.Errorf("expected the 2 retried bodies to be closed, got %d", closed)
+	}
+}
+
+func TestRetryMaxAttempts(t *testing.T) {
+	var attempts, closed int
+	client := &Client{
+		Retry:     &RetryPolicy{MaxAttempts: 4, BaseDelay: time.Millisecond},
+		Transport: scriptedTransport(&attempts, &closed, [2]string{"40", "Try later"}),
+	}
+	res, err := client.Fetch("gemini://example.invalid/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.Status != StatusTemporaryFailure || res.Meta != "Try later" {
+		t.Errorf("expected the last response, got %d %q", res.Status, res.Meta)
+	}
+	if attempts != 4 {
+		t.Errorf("expected 4 attempts, got %d", attempts)
+	}
+	if closed != 3 {
+		t.Errorf("expected the last body to be left open, got %d closed", closed)
+	}
+}
+
+func TestRetryNotTemporary(t *testing.T) {
+	var attempts, closed int
+	client := &Client{
+		Retry:     &RetryPolicy{BaseDelay: time.Millisecond},
+		Transport: scriptedTransport(&attempts, &closed, [2]string{"51", "Not found"}),
+	}
+	if _, err := client.Fetch("gemini://example.invalid/"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if attempts != 1 {
+		t.Errorf("expected 1 attempt, got %d", attempts)
+	}
+}
+
+func TestRetrySlowDownTooLong(t *testing.T) {
+	var attempts, closed int
+	client := &Client{
+		Retry:     &RetryPolicy{MaxDelay: time.Second},
+		Transport: scriptedTransport(&attempts, &closed, [2]string{"44", "60"}),
+	}
+	res, err := client.Fetch("gemini://example.invalid/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.Status != StatusSlowDown || attempts != 1 {
+		t.Errorf("expected the slow down response without retrying, got %d after %d attempts", res.Status, attempts)
+	}
+}
+
+func TestRetryNetworkErrors(t *testing.T) {
+	tests := []struct {
+		err      error
+		attempts int
+	}{
+		{&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, 3},
+		{&HeaderError{Line: "bad", Err: ErrMalformedHeader}, 1},
+		{&CertError{Host: "example.invalid:1965", Err: ErrCertExpired}, 1},
+	}
+	for _, tt := range tests {
+		attempts := 0
+		client := &Client{
+			Retry: &RetryPolicy{BaseDelay: time.Millisecond},
+			Transport: RoundTripperFunc(func(req *Request) (*Response, error) {
+				attempts++
+				return nil, tt.err
+			}),
+		}
+		if _, err := client.Fetch("gemini://example.invalid/"); err != tt.err {
+			t.Errorf("expected %v, got %v", tt.err, err)
+		}
+		if attempts != tt.attempts {
+			t.Errorf("%v: expected %d attempts, got %d", tt.err, tt.attempts, attempts)
+		}
+	}
+}
+
+func TestRetryConnectTimeout(t *testing.T) {
+	// Accept connections but never answer the handshake
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	accepted := make(chan net.Conn, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- conn
+		}
+	}()
+
+	client := &Client{
+		ConnectTimeout: 100 * time.Millisecond,
+		Retry:          &RetryPolicy{BaseDelay: time.Millisecond},
+	}
+	if _, err := client.Fetch("gemini://" + l.Addr().String() + "/"); err == nil {
+		t.Fatalf("expected the handshake to time out")
+	}
+	for i := 0; i < DefaultMaxAttempts; i++ {
+		select {
+		case conn := <-accepted:
+			conn.Close()
+		case <-time.After(time.Second):
+			t.Fatalf("expected %d attempts, got %d", DefaultMaxAttempts, i)
+		}
+	}
+}
+
+func TestRetryContextCanceled(t *testing.T) {
+	var attempts, closed int
+	client := &Client{
+		Retry:     &RetryPolicy{},
+		Transport: scriptedTransport(&attempts, &closed, [2]string{"44", "10"}),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := client.FetchContext(ctx, "gemini://example.invalid/")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context deadline error, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("waiting wasn't stopped by the context")
+	}
+	if attempts != 1 || closed != 1 {
+		t.Errorf("expected 1 attempt with its body closed, got %d attempts and %d closed", attempts, closed)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := &RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for retry, max := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		max *= time.Millisecond
+		d := p.backoff(retry)
+		if d < max/2 || d > max {
+			t.Errorf("retry %d: expected delay between %v and %v, got %v", retry, max/2, max, d)
+		}
+	}
+}
@@ -0,0 +1,358 @@
+package gemini
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrServerClosed is returned by Server.Serve and Server.ListenAndServe
+	// after the server has been closed.
+	ErrServerClosed = errors.New("server closed")
+
+	// ErrInvalidMeta is returned by ResponseWriter.WriteHeader when the meta
+	// string contains a CR or LF.
+	ErrInvalidMeta = errors.New("meta string contains a line break")
+
+	// ErrHeaderWritten is returned by ResponseWriter.WriteHeader when the
+	// header has already been written.
+	ErrHeaderWritten = errors.New("header was already written")
+
+	// ErrBodyNotAllowed is returned by ResponseWriter.Write when the status
+	// is not a success status, and so the response can't have a body.
+	ErrBodyNotAllowed = errors.New("response status does not allow a body")
+)
+
+// A Handler responds to a Gemini request.
+//
+// ServeGemini should write the response header and body to the
+// ResponseWriter and then return. If it returns without writing anything, a
+// successful response with no body is sent.
+type Handler interface {
+	ServeGemini(w ResponseWriter, r *Request)
+}
+
+// HandlerFunc allows the use of an ordinary function as a Handler.
+type HandlerFunc func(w ResponseWriter, r *Request)
+
+// ServeGemini calls f(w, r).
+func (f HandlerFunc) ServeGemini(w ResponseWriter, r *Request) {
+	f(w, r)
+}
+
+// ResponseWriter is used by a Handler to write a response.
+type ResponseWriter interface {
+	// WriteHeader writes the response header. It returns an error without
+	// writing anything if the status isn't valid according to IsStatusValid,
+	// or if the meta string is invalid or too long. It can only be called once.
+	//
+	// For successful responses, meta is the MIME type of the body. If it's
+	// empty, clients will assume "text/gemini; charset=utf-8".
+	WriteHeader(status int, meta string) error
+
+	// Write writes to the response body. If WriteHeader hasn't been called,
+	// it first writes a successful header with the text/gemini MIME type.
+	// Writing fails with ErrBodyNotAllowed if the response status is not a
+	// success status.
+	Write(p []byte) (int, error)
+}
+
+// response implements ResponseWriter.
+type response struct {
+	conn        net.Conn
+	wroteHeader bool
+	status      int
+}
+
+func (w *response) WriteHeader(status int, meta string) error {
+	if w.wroteHeader {
+		return ErrHeaderWritten
+	}
+	if !IsStatusValid(status) {
+		return fmt.Errorf("%w: %d", ErrInvalidStatus, status)
+	}
+	if len(meta) > MetaMaxLength {
+		return ErrMetaTooLong
+	}
+	if strings.ContainsAny(meta, "\r\n") {
+		return ErrInvalidMeta
+	}
+
+	w.wroteHeader = true
+	w.status = status
+	_, err := fmt.Fprintf(w.conn, "%d %s\r\n", status, meta)
+	return err
+}
+
+func (w *response) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		if err := w.WriteHeader(StatusSuccess, "text/gemini"); err != nil {
+			return 0, err
+		}
+	}
+	if SimplifyStatus(w.status) != StatusSuccess {
+		return 0, ErrBodyNotAllowed
+	}
+	return w.conn.Write(p)
+}
+
+// Server is a Gemini server.
+type Server struct {
+	// Addr is the TCP address to listen on, ":1965" if empty.
+	Addr string
+
+	// Handler is called for every request. If it's nil, all requests get a
+	// Not Found response.
+	Handler Handler
+
+	// TLSConfig is used for all connections. It must provide a cert, using
+	// Certificates or GetCertificate, unless ListenAndServeTLS is used.
+	// Client certs are always requested but not verified, so that handlers can
+	// use them for identification as is usual in Gemini.
+	TLSConfig *tls.Config
+
+	// ReadTimeout is the max amount of time allowed for the TLS handshake and
+	// reading the request.
+	ReadTimeout time.Duration
+
+	// WriteTimeout is the max amount of time allowed for writing the response,
+	// starting after the request has been read. It should not be set if you
+	// want to support streams.
+	WriteTimeout time.Duration
+
+	// ErrorLog is used to log errors when accepting connections, and panics
+	// in handlers. If it's nil, the log package's standard logger is used.
+	ErrorLog *log.Logger
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	closed    bool
+	ctx       context.Context
+	cancel    context.CancelFunc
+}
+
+// ListenAndServe listens on s.Addr and then calls Serve to handle requests.
+func (s *Server) ListenAndServe() error {
+	addr := s.Addr
+	if addr == "" {
+		addr = ":1965"
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// ListenAndServeTLS is like ListenAndServe, but it loads the server cert and
+// key from the provided PEM files, instead of using the ones in s.TLSConfig.
+func (s *Server) ListenAndServeTLS(certFile, keyFile string) error {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	var conf *tls.Config
+	if s.TLSConfig == nil {
+		conf = &tls.Config{}
+	} else {
+		conf = s.TLSConfig.Clone()
+	}
+	conf.Certificates = []tls.Certificate{cert}
+
+	s.mu.Lock()
+	s.TLSConfig = conf
+	s.mu.Unlock()
+	return s.ListenAndServe()
+}
+
+// Serve accepts connections on l, wraps them in TLS and handles the requests
+// on them in new goroutines. It always returns a non-nil error, and closes l.
+// After Close has been called, the returned error is ErrServerClosed.
+func (s *Server) Serve(l net.Listener) error {
+	defer l.Close()
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrServerClosed
+	}
+	if s.listeners == nil {
+		s.listeners = make(map[net.Listener]struct{})
+		s.ctx, s.cancel = context.WithCancel(context.Background())
+	}
+	s.listeners[l] = struct{}{}
+	conf := s.tlsConfig()
+	ctx := s.ctx
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+	}()
+
+	var tempDelay time.Duration // How long to sleep on accept failure
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				// Back off, like net/http does
+				if tempDelay == 0 {
+					tempDelay = 5 * time.Millisecond
+				} else {
+					tempDelay *= 2
+				}
+				if tempDelay > time.Second {
+					tempDelay = time.Second
+				}
+				s.logf("gemini: accept error: %v; retrying in %v", err, tempDelay)
+				time.Sleep(tempDelay)
+				continue
+			}
+			return err
+		}
+		tempDelay = 0
+		go s.serveConn(ctx, tls.Server(conn, conf))
+	}
+}
+
+// Close immediately closes all listeners. Connections that are being handled
+// are not closed, but the contexts of their requests are canceled.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	if s.cancel != nil {
+		s.cancel()
+	}
+	var err error
+	for l := range s.listeners {
+		if cerr := l.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// tlsConfig returns the config to use for connections. The caller must hold
+// s.mu.
+func (s *Server) tlsConfig() *tls.Config {
+	var conf *tls.Config
+	if s.TLSConfig == nil {
+		conf = &tls.Config{}
+	} else {
+		conf = s.TLSConfig.Clone()
+	}
+	if conf.MinVersion == 0 {
+		conf.MinVersion = tls.VersionTLS12
+	}
+	// Request client certs, but allow self-signed ones
+	conf.ClientAuth = tls.RequestClientCert
+	return conf
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.ErrorLog != nil {
+		s.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+// serveConn reads the request from conn and calls the handler.
+func (s *Server) serveConn(ctx context.Context, conn *tls.Conn) {
+	defer conn.Close()
+	defer func() {
+		if err := recover(); err != nil {
+			s.logf("gemini: panic serving %v: %v\n%s", conn.RemoteAddr(), err, debug.Stack())
+		}
+	}()
+
+	if s.ReadTimeout != 0 {
+		conn.SetDeadline(time.Now().Add(s.ReadTimeout))
+	}
+	if err := conn.HandshakeContext(ctx); err != nil {
+		return
+	}
+	u, err := readRequestURL(conn)
+
+	conn.SetDeadline(time.Time{})
+	if s.WriteTimeout != 0 {
+		conn.SetWriteDeadline(time.Now().Add(s.WriteTimeout))
+	}
+
+	w := &response{conn: conn}
+	if err != nil {
+		w.WriteHeader(StatusBadRequest, err.Error())
+		return
+	}
+
+	state := conn.ConnectionState()
+	r := &Request{
+		URL:        u,
+		RemoteAddr: conn.RemoteAddr().String(),
+		TLS:        &state,
+		ctx:        ctx,
+	}
+	if s.Handler == nil {
+		NotFound(w, r)
+	} else {
+		s.Handler.ServeGemini(w, r)
+	}
+	if !w.wroteHeader {
+		w.WriteHeader(StatusSuccess, "text/gemini")
+	}
+}
+
+// readRequestURL reads and parses the request line, which must be an absolute
+// URL of at most URLMaxLength bytes, followed by CRLF.
+func readRequestURL(r io.Reader) (*url.URL, error) {
+	// Room for the URL and CRLF
+	br := bufio.NewReaderSize(io.LimitReader(r, URLMaxLength+2), URLMaxLength+2)
+	line, err := br.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return nil, fmt.Errorf("request is too long")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request")
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, fmt.Errorf("request does not end with CRLF")
+	}
+	line = line[:len(line)-2]
+
+	u, err := url.Parse(string(line))
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL")
+	}
+	if !u.IsAbs() || u.Host == "" {
+		return nil, fmt.Errorf("URL is not absolute")
+	}
+	if u.User != nil {
+		return nil, fmt.Errorf("URL must not contain userinfo")
+	}
+	return u, nil
+}
@@ -0,0 +1,120 @@
+package gemini
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+)
+
+// newServer starts s on localhost with a test cert, and returns its address.
+// The server is closed when the test ends.
+func newServer(t *testing.T, s *Server) string {
+	t.Helper()
+	s.TLSConfig = &tls.Config{Certificates: []tls.Certificate{newTestCert(t)}}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	go s.Serve(l)
+	t.Cleanup(func() { s.Close() })
+	return l.Addr().String()
+}
+
+// rawRequest sends the raw request line to the server and returns the
+// response header line.
+func rawRequest(t *testing.T, addr, line string) string {
+	t.Helper()
+	conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer conn.Close()
+	fmt.Fprint(conn, line)
+	header, _, _ := readHeader(conn, false)
+	return string(header)
+}
+
+func TestServer(t *testing.T) {
+	addr := newServer(t, &Server{Handler: HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.WriteHeader(StatusSuccess, "text/plain")
+		fmt.Fprintf(w, "%s from %s", r.URL.Path, r.RemoteAddr)
+	})})
+
+	res, err := (&Client{}).Fetch("gemini://" + addr + "/hello")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer res.Body.Close()
+	if res.Status != StatusSuccess || res.Meta != "text/plain" {
+		t.Errorf("unexpected header: %d %s", res.Status, res.Meta)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	if !strings.HasPrefix(string(body), "/hello from 127.0.0.1:") {
+		t.Errorf("unexpected body %q", body)
+	}
+}
+
+func TestServerBadRequest(t *testing.T) {
+	addr := newServer(t, &Server{Handler: HandlerFunc(func(w ResponseWriter, r *Request) {
+		t.Errorf("handler should not be called for %s", r.URL)
+	})})
+
+	tests := []string{
+		"gemini://example.com/\n",
+		"/relative\r\n",
+		"gemini://user@example.com/\r\n",
+		"gemini://example.com/" + strings.Repeat("a", URLMaxLength) + "\r\n",
+	}
+	for _, line := range tests {
+		header := rawRequest(t, addr, line)
+		if !strings.HasPrefix(header, "59 ") {
+			t.Errorf("expected bad request for %q, got %q", line, header)
+		}
+	}
+}
+
+func TestResponseWriterErrors(t *testing.T) {
+	errs := make(chan []error, 1)
+	addr := newServer(t, &Server{Handler: HandlerFunc(func(w ResponseWriter, r *Request) {
+		errs <- []error{
+			w.WriteHeader(99, ""),
+			w.WriteHeader(StatusSuccess, strings.Repeat("a", MetaMaxLength+1)),
+			w.WriteHeader(StatusSuccess, "text/plain\r\n"),
+			w.WriteHeader(StatusNotFound, "gone"),
+			w.WriteHeader(StatusSuccess, "text/plain"),
+			func() error { _, err := w.Write([]byte("body")); return err }(),
+		}
+	})})
+
+	header := rawRequest(t, addr, "gemini://example.com/\r\n")
+	if header != "51 gone" {
+		t.Errorf("unexpected header %q", header)
+	}
+	expected := []error{ErrInvalidStatus, ErrMetaTooLong, ErrInvalidMeta, nil, ErrHeaderWritten, ErrBodyNotAllowed}
+	for i, err := range <-errs {
+		if !errors.Is(err, expected[i]) {
+			t.Errorf("call %d: expected %v, got %v", i, expected[i], err)
+		}
+	}
+}
+
+func TestServerClose(t *testing.T) {
+	s := &Server{TLSConfig: &tls.Config{Certificates: []tls.Certificate{newTestCert(t)}}}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	done := make(chan error)
+	go func() { done <- s.Serve(l) }()
+
+	// Make sure the server is serving before closing it
+	rawRequest(t, l.Addr().String(), "gemini://example.com/\r\n")
+	s.Close()
+	if err := <-done; err != ErrServerClosed {
+		t.Errorf("expected ErrServerClosed, got %v", err)
+	}
+}
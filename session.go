@@ -0,0 +1,77 @@
+package gemini
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+)
+
+// DefaultSessionCacheSize is the number of TLS sessions a Client keeps if
+// Client.SessionCacheSize is not set.
+const DefaultSessionCacheSize = 64
+
+// sessionCache returns the cache to use for a connection to host with the
+// client cert, or nil if sessions shouldn't be resumed. If cache is not nil,
+// it's used instead of the client's own cache.
+func (c *Client) sessionCache(host string, clientCert tls.Certificate, cache tls.ClientSessionCache) tls.ClientSessionCache {
+	if cache == nil && c.SessionCacheSize < 0 {
+		return nil
+	}
+
+	// A resumed session keeps the client cert it was made with, so sessions
+	// can't be shared between identities. When the cert is only picked
+	// during the handshake, it's not known which session could be used.
+	var id string
+	if len(clientCert.Certificate) > 0 {
+		sum := sha256.Sum256(clientCert.Certificate[0])
+		id = hex.EncodeToString(sum[:])
+	} else if c.GetClientCertificate != nil {
+		return nil
+	}
+
+	if cache == nil {
+		cache = c.ownSessionCache()
+	}
+	return &keyedSessionCache{cache: cache, prefix: host + " " + id + " "}
+}
+
+// clientSessions is the session cache of a Client. It records the client it
+// was made for, so that a copy of the client doesn't share it.
+type clientSessions struct {
+	client *Client
+	cache  tls.ClientSessionCache
+}
+
+// ownSessionCache returns the client's session cache, creating it the first
+// time it's needed.
+func (c *Client) ownSessionCache() tls.ClientSessionCache {
+	for {
+		old := c.sessions.Load()
+		if s, ok := old.(*clientSessions); ok && s.client == c {
+			return s.cache
+		}
+		size := c.SessionCacheSize
+		if size == 0 {
+			size = DefaultSessionCacheSize
+		}
+		s := &clientSessions{client: c, cache: tls.NewLRUClientSessionCache(size)}
+		if c.sessions.CompareAndSwap(old, s) {
+			return s.cache
+		}
+	}
+}
+
+// keyedSessionCache stores sessions in a shared cache under keys with a
+// prefix, so that they are only used for the same host and client cert.
+type keyedSessionCache struct {
+	cache  tls.ClientSessionCache
+	prefix string
+}
+
+func (s *keyedSessionCache) Get(sessionKey string) (*tls.ClientSessionState, bool) {
+	return s.cache.Get(s.prefix + sessionKey)
+}
+
+func (s *keyedSessionCache) Put(sessionKey string, cs *tls.ClientSessionState) {
+	s.cache.Put(s.prefix+sessionKey, cs)
+}
@@ -0,0 +1,101 @@
+package gemini
+
+import (
+	"io/ioutil"
+	"net"
+	"testing"
+)
+
+func TestSessionResumption(t *testing.T) {
+	addr := newTestServer(t, func(conn net.Conn) {
+		readRequest(conn)
+		conn.Write([]byte("20 text/plain\r\nhi"))
+	})
+
+	fetch := func(client *Client, certPEM, keyPEM []byte) *Response {
+		t.Helper()
+		var res *Response
+		var err error
+		if certPEM == nil {
+			res, err = client.Fetch("gemini://" + addr + "/")
+		} else {
+			res, err = client.FetchWithCert("gemini://"+addr+"/", certPEM, keyPEM)
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		// Reading the body also reads the session ticket
+		ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		return res
+	}
+
+	client := &Client{}
+	if fetch(client, nil, nil).Resumed {
+		t.Errorf("first connection was resumed")
+	}
+	if !fetch(client, nil, nil).Resumed {
+		t.Errorf("second connection was not resumed")
+	}
+
+	// A different identity gets its own session
+	id, err := NewIdentity(IdentityOptions{CommonName: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM, keyPEM, err := id.PEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fetch(client, certPEM, keyPEM).Resumed {
+		t.Errorf("session was resumed with a different client cert")
+	}
+	if !fetch(client, certPEM, keyPEM).Resumed {
+		t.Errorf("session with client cert was not resumed")
+	}
+
+	disabled := &Client{SessionCacheSize: -1}
+	fetch(disabled, nil, nil)
+	if fetch(disabled, nil, nil).Resumed {
+		t.Errorf("session was resumed with resumption disabled")
+	}
+}
+
+func TestSessionCacheClientCopy(t *testing.T) {
+	addr := newTestServer(t, func(conn net.Conn) {
+		readRequest(conn)
+		conn.Write([]byte("20 text/plain\r\nhi"))
+	})
+	fetch := func(client *Client) *Response {
+		t.Helper()
+		res, err := client.Fetch("gemini://" + addr + "/")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		return res
+	}
+
+	client := &Client{}
+	fetch(client)
+
+	// A copy of a client that was already used has its own cache and
+	// settings, and doesn't resume the original's sessions
+	copied := *client
+	copied.SessionCacheSize = -1
+	fetch(&copied)
+	if fetch(&copied).Resumed {
+		t.Errorf("copy with resumption disabled resumed a session")
+	}
+	other := *client
+	if fetch(&other).Resumed {
+		t.Errorf("copy resumed a session of the original client")
+	}
+	if !fetch(&other).Resumed {
+		t.Errorf("copy did not resume its own session")
+	}
+	if !fetch(client).Resumed {
+		t.Errorf("original client did not resume its session")
+	}
+}
@@ -0,0 +1,259 @@
+package gemini
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CertStore decides whether server certs are trusted. See Client.CertStore.
+type CertStore interface {
+	// Check is called with the host that was connected to, including the port,
+	// for example "example.com:1965", and the cert the server presented.
+	// It returns a non-nil error if the cert should not be trusted.
+	Check(host string, cert *x509.Certificate) error
+}
+
+// FingerprintAlgorithm is the only algorithm used for KnownHost fingerprints.
+const FingerprintAlgorithm = "sha256"
+
+// Fingerprint returns the base64 encoded SHA-256 hash of the raw cert.
+// This is the fingerprint format used by TOFUStore and by other Gemini
+// clients that use known_hosts files.
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// KnownHost is a cert fingerprint that has been pinned for a host.
+type KnownHost struct {
+	// Host is the hostname, with the port only if it's not 1965.
+	Host        string
+	Algorithm   string
+	Fingerprint string
+	// Expires is when the pinned cert expires. After that time, any new cert
+	// is trusted and pinned instead. It can be the zero value, which means the
+	// pin never expires.
+	Expires time.Time
+}
+
+// String returns the known host as a line of a known_hosts file, without
+// the newline.
+//
+//	<host> <algorithm> <fingerprint> [<expiry as a Unix timestamp>]
+func (kh KnownHost) String() string {
+	s := kh.Host + " " + kh.Algorithm + " " + kh.Fingerprint
+	if !kh.Expires.IsZero() {
+		s += " " + strconv.FormatInt(kh.Expires.Unix(), 10)
+	}
+	return s
+}
+
+// ParseKnownHosts parses known hosts in the known_hosts format used by
+// Gemini clients. See KnownHost.String for the format of a line.
+// Empty lines and lines starting with # are ignored.
+func ParseKnownHosts(r io.Reader) ([]KnownHost, error) {
+	var hosts []KnownHost
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 && len(fields) != 4 {
+			return nil, fmt.Errorf("known hosts line %d: expected 3 or 4 fields, got %d", n, len(fields))
+		}
+		kh := KnownHost{
+			Host:        knownHostKey(fields[0]),
+			Algorithm:   fields[1],
+			Fingerprint: fields[2],
+		}
+		if len(fields) == 4 {
+			unix, err := strconv.ParseInt(fields[3], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("known hosts line %d: invalid expiry: %w", n, err)
+			}
+			kh.Expires = time.Unix(unix, 0)
+		}
+		hosts = append(hosts, kh)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return hosts, nil
+}
+
+// knownHostKey normalizes a host so that it can be used as a key. The port is
+// removed if it's the default one.
+func knownHostKey(host string) string {
+	hostname, port, err := net.SplitHostPort(host)
+	if err != nil {
+		// No port
+		return strings.ToLower(host)
+	}
+	if port == "1965" {
+		return strings.ToLower(hostname)
+	}
+	return strings.ToLower(net.JoinHostPort(hostname, port))
+}
+
+// CertMismatchError is returned by TOFUStore when a host presents a cert that
+// doesn't match the one that was pinned for it. This can mean the connection
+// is being intercepted, or that the server changed its cert before the old
+// one expired.
+type CertMismatchError struct {
+	Host           string
+	OldFingerprint string
+	NewFingerprint string
+	// Expires is when the pinned cert expires.
+	Expires time.Time
+	// Cert is the new cert presented by the server. It can be passed to
+	// TOFUStore.Trust to override the pin.
+	Cert *x509.Certificate
+}
+
+func (e *CertMismatchError) Error() string {
+	return fmt.Sprintf("cert for %s does not match the trusted one: got fingerprint %s, expected %s",
+		e.Host, e.NewFingerprint, e.OldFingerprint)
+}
+
+// TOFUStore is a CertStore that implements trust-on-first-use. The first cert
+// seen for a host is pinned, and later connections fail with a
+// *CertMismatchError if the host presents a different cert. Once the pinned
+// cert has expired, the next cert seen for the host is pinned instead.
+//
+// The zero value is an empty store that is only kept in memory, like the one
+// returned by NewTOFUStore. It is safe for concurrent use.
+type TOFUStore struct {
+	mu    sync.Mutex
+	hosts map[string]KnownHost
+	path  string
+}
+
+// NewTOFUStore returns an empty TOFUStore that is only kept in memory.
+func NewTOFUStore() *TOFUStore {
+	return &TOFUStore{hosts: make(map[string]KnownHost)}
+}
+
+// OpenTOFUStore returns a TOFUStore backed by the known_hosts file at path.
+// The file doesn't need to exist yet, it is created when the first cert is
+// pinned. New pins are appended to it, and when a host appears more than once,
+// the last line wins.
+func OpenTOFUStore(path string) (*TOFUStore, error) {
+	s := NewTOFUStore()
+	s.path = path
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	hosts, err := ParseKnownHosts(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	for _, kh := range hosts {
+		s.hosts[kh.Host] = kh
+	}
+	return s, nil
+}
+
+// Check implements CertStore.
+func (s *TOFUStore) Check(host string, cert *x509.Certificate) error {
+	key := knownHostKey(host)
+	fp := Fingerprint(cert)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kh, ok := s.hosts[key]
+	if ok && kh.Algorithm == FingerprintAlgorithm && kh.Fingerprint == fp {
+		return nil
+	}
+	if ok && (kh.Expires.IsZero() || time.Now().Before(kh.Expires)) {
+		return &CertMismatchError{
+			Host:           host,
+			OldFingerprint: kh.Fingerprint,
+			NewFingerprint: fp,
+			Expires:        kh.Expires,
+			Cert:           cert,
+		}
+	}
+	// First use, or the pinned cert has expired
+	return s.add(key, cert)
+}
+
+// Trust pins the cert for the host, replacing any existing pin. It can be used
+// to accept a new cert after a *CertMismatchError.
+func (s *TOFUStore) Trust(host string, cert *x509.Certificate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.add(knownHostKey(host), cert)
+}
+
+// Lookup returns the pin for the host, if there is one.
+func (s *TOFUStore) Lookup(host string) (KnownHost, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kh, ok := s.hosts[knownHostKey(host)]
+	return kh, ok
+}
+
+// WriteTo writes all the pins to w in the known_hosts format.
+func (s *TOFUStore) WriteTo(w io.Writer) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var total int64
+	for _, kh := range s.hosts {
+		n, err := fmt.Fprintln(w, kh)
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// add pins the cert for the key. The caller must hold s.mu.
+func (s *TOFUStore) add(key string, cert *x509.Certificate) error {
+	kh := KnownHost{
+		Host:        key,
+		Algorithm:   FingerprintAlgorithm,
+		Fingerprint: Fingerprint(cert),
+		Expires:     cert.NotAfter,
+	}
+	if s.path != "" {
+		f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to open known hosts file: %w", err)
+		}
+		_, err = fmt.Fprintln(f, kh)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write to known hosts file: %w", err)
+		}
+	}
+	if s.hosts == nil {
+		s.hosts = make(map[string]KnownHost)
+	}
+	s.hosts[key] = kh
+	return nil
+}
@@ -0,0 +1,127 @@
+package gemini
+
+import (
+	"crypto/x509"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestX509Cert(t *testing.T) *x509.Certificate {
+	t.Helper()
+	cert, err := x509.ParseCertificate(newTestCert(t).Certificate[0])
+	if err != nil {
+		t.Fatalf("failed to parse cert: %v", err)
+	}
+	return cert
+}
+
+func TestTOFUStore(t *testing.T) {
+	s := NewTOFUStore()
+	cert := newTestX509Cert(t)
+	other := newTestX509Cert(t)
+
+	if err := s.Check("example.com:1965", cert); err != nil {
+		t.Fatalf("first use should be trusted, got %v", err)
+	}
+	if err := s.Check("example.com:1965", cert); err != nil {
+		t.Fatalf("pinned cert should be trusted, got %v", err)
+	}
+	if err := s.Check("example.com:1966", other); err != nil {
+		t.Fatalf("different port should have its own pin, got %v", err)
+	}
+
+	err := s.Check("example.com:1965", other)
+	var mismatch *CertMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("expected *CertMismatchError, got %v", err)
+	}
+	if mismatch.OldFingerprint != Fingerprint(cert) || mismatch.NewFingerprint != Fingerprint(other) {
+		t.Errorf("mismatch error has wrong fingerprints: %v", mismatch)
+	}
+
+	if err := s.Trust("example.com:1965", other); err != nil {
+		t.Fatalf("failed to trust cert: %v", err)
+	}
+	if err := s.Check("example.com:1965", other); err != nil {
+		t.Fatalf("trusted cert should pass, got %v", err)
+	}
+}
+
+func TestTOFUStoreZeroValue(t *testing.T) {
+	var s TOFUStore
+	cert := newTestX509Cert(t)
+	if err := s.Check("example.com:1965", cert); err != nil {
+		t.Fatalf("first use should be trusted, got %v", err)
+	}
+	if _, ok := s.Lookup("example.com"); !ok {
+		t.Errorf("cert was not pinned")
+	}
+}
+
+func TestTOFUStoreExpiredPin(t *testing.T) {
+	hosts, err := ParseKnownHosts(strings.NewReader("example.com sha256 AAAA 1000\n"))
+	if err != nil {
+		t.Fatalf("failed to parse known hosts: %v", err)
+	}
+	s := NewTOFUStore()
+	s.hosts[hosts[0].Host] = hosts[0]
+
+	cert := newTestX509Cert(t)
+	if err := s.Check("example.com:1965", cert); err != nil {
+		t.Fatalf("cert should be re-pinned after old pin expired, got %v", err)
+	}
+	kh, _ := s.Lookup("example.com")
+	if kh.Fingerprint != Fingerprint(cert) {
+		t.Errorf("cert was not re-pinned")
+	}
+}
+
+func TestOpenTOFUStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	cert := newTestX509Cert(t)
+
+	s, err := OpenTOFUStore(path)
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	if err := s.Check("example.com:1965", cert); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	s, err = OpenTOFUStore(path)
+	if err != nil {
+		t.Fatalf("failed to reopen store: %v", err)
+	}
+	kh, ok := s.Lookup("example.com:1965")
+	if !ok || kh.Fingerprint != Fingerprint(cert) || kh.Expires.Unix() != cert.NotAfter.Unix() {
+		t.Fatalf("pin was not persisted: %+v", kh)
+	}
+}
+
+func TestParseKnownHosts(t *testing.T) {
+	hosts, err := ParseKnownHosts(strings.NewReader(
+		"# comment\n\nExample.com sha256 AAAA\nexample.org:1966 sha256 BBBB 1700000000\n",
+	))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []KnownHost{
+		{"example.com", "sha256", "AAAA", time.Time{}},
+		{"example.org:1966", "sha256", "BBBB", time.Unix(1700000000, 0)},
+	}
+	if len(hosts) != len(expected) {
+		t.Fatalf("expected %d hosts, got %d", len(expected), len(hosts))
+	}
+	for i := range expected {
+		if hosts[i] != expected[i] {
+			t.Errorf("expected %+v, got %+v", expected[i], hosts[i])
+		}
+	}
+
+	if _, err := ParseKnownHosts(strings.NewReader("example.com sha256\n")); err == nil {
+		t.Errorf("expected error for line with missing fingerprint")
+	}
+}
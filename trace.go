@@ -0,0 +1,149 @@
+package gemini
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http/httptrace"
+)
+
+// ClientTrace is a set of hooks that are called during the phases of a
+// request made by a Client, for example to measure how long each phase takes.
+// Any of them can be nil. They are set for a request by adding the trace to
+// its context with WithClientTrace.
+//
+// When a request is retried or redirects are followed, the hooks are called
+// again for each new request. They can be called from other goroutines.
+type ClientTrace struct {
+	// DNSStart is called when a DNS lookup for the host starts. It's not
+	// called when connecting to an IP address, or when Client.Proxy is used.
+	DNSStart func(host string)
+	// DNSDone is called when the DNS lookup ends, with the addresses found.
+	DNSDone func(addrs []net.IPAddr, err error)
+
+	// ConnectStart is called when a TCP connection to the server starts,
+	// and ConnectDone when it's made, or has failed. With a dual stack host,
+	// they can be called more than once, for different addresses. They are
+	// not called when Client.Proxy is used.
+	ConnectStart func(network, addr string)
+	ConnectDone  func(network, addr string, err error)
+
+	// ProxyDialStart is called before Client.Proxy is used to connect to the
+	// host:port, and ProxyDialDone after it returns.
+	ProxyDialStart func(addr string)
+	ProxyDialDone  func(addr string, err error)
+
+	// TLSHandshakeStart is called when the TLS handshake starts, and
+	// TLSHandshakeDone when it ends.
+	TLSHandshakeStart func()
+	TLSHandshakeDone  func(state tls.ConnectionState, err error)
+
+	// VerifiedCert is called after the server cert is checked by the client,
+	// with the host:port connected to. err is the reason the cert was
+	// rejected, or nil if it was trusted.
+	VerifiedCert func(host string, cert *x509.Certificate, err error)
+
+	// WroteRequest is called after the request has been written, or writing
+	// it failed.
+	WroteRequest func(err error)
+
+	// GotFirstResponseByte is called when the first byte of the response
+	// header is read.
+	GotFirstResponseByte func()
+}
+
+type clientTraceKey struct{}
+
+// WithClientTrace returns a copy of ctx with the trace added, so that the
+// trace's hooks are called for requests made with the returned context.
+func WithClientTrace(ctx context.Context, trace *ClientTrace) context.Context {
+	return context.WithValue(ctx, clientTraceKey{}, trace)
+}
+
+// ContextClientTrace returns the ClientTrace added to ctx, or nil if there
+// isn't one.
+func ContextClientTrace(ctx context.Context) *ClientTrace {
+	trace, _ := ctx.Value(clientTraceKey{}).(*ClientTrace)
+	return trace
+}
+
+// dialContext returns a context that makes net.Dialer call the DNS and
+// connect hooks of the trace, which can be nil.
+func (t *ClientTrace) dialContext(ctx context.Context) context.Context {
+	if t == nil || (t.DNSStart == nil && t.DNSDone == nil && t.ConnectStart == nil && t.ConnectDone == nil) {
+		return ctx
+	}
+	// The net package supports the httptrace hooks for dialing
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart: func(info httptrace.DNSStartInfo) {
+			if t.DNSStart != nil {
+				t.DNSStart(info.Host)
+			}
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			if t.DNSDone != nil {
+				t.DNSDone(info.Addrs, info.Err)
+			}
+		},
+		ConnectStart: t.ConnectStart,
+		ConnectDone:  t.ConnectDone,
+	})
+}
+
+// The methods below call the hook of the same name if the trace and the hook
+// aren't nil.
+
+func (t *ClientTrace) proxyDialStart(addr string) {
+	if t != nil && t.ProxyDialStart != nil {
+		t.ProxyDialStart(addr)
+	}
+}
+
+func (t *ClientTrace) proxyDialDone(addr string, err error) {
+	if t != nil && t.ProxyDialDone != nil {
+		t.ProxyDialDone(addr, err)
+	}
+}
+
+func (t *ClientTrace) tlsHandshakeStart() {
+	if t != nil && t.TLSHandshakeStart != nil {
+		t.TLSHandshakeStart()
+	}
+}
+
+func (t *ClientTrace) tlsHandshakeDone(state tls.ConnectionState, err error) {
+	if t != nil && t.TLSHandshakeDone != nil {
+		t.TLSHandshakeDone(state, err)
+	}
+}
+
+func (t *ClientTrace) verifiedCert(host string, cert *x509.Certificate, err error) {
+	if t != nil && t.VerifiedCert != nil {
+		t.VerifiedCert(host, cert, err)
+	}
+}
+
+func (t *ClientTrace) wroteRequest(err error) {
+	if t != nil && t.WroteRequest != nil {
+		t.WroteRequest(err)
+	}
+}
+
+// firstByteReader calls the GotFirstResponseByte hook on the first
+// successful read.
+type firstByteReader struct {
+	io.ReadCloser
+	trace *ClientTrace
+	got   bool
+}
+
+func (r *firstByteReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 && !r.got {
+		r.got = true
+		r.trace.GotFirstResponseByte()
+	}
+	return n, err
+}
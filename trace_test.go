@@ -0,0 +1,107 @@
+package gemini
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// recordTrace returns a trace that records the names of the hooks called, and
+// a function that returns them.
+func recordTrace() (*ClientTrace, func() []string) {
+	var mu sync.Mutex
+	var events []string
+	record := func(event string) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	}
+	trace := &ClientTrace{
+		DNSStart:          func(host string) { record("DNSStart") },
+		DNSDone:           func(addrs []net.IPAddr, err error) { record("DNSDone") },
+		ConnectStart:      func(network, addr string) { record("ConnectStart") },
+		ConnectDone:       func(network, addr string, err error) { record("ConnectDone") },
+		ProxyDialStart:    func(addr string) { record("ProxyDialStart") },
+		ProxyDialDone:     func(addr string, err error) { record("ProxyDialDone") },
+		TLSHandshakeStart: func() { record("TLSHandshakeStart") },
+		TLSHandshakeDone:  func(state tls.ConnectionState, err error) { record("TLSHandshakeDone") },
+		VerifiedCert: func(host string, cert *x509.Certificate, err error) {
+			if err != nil {
+				record("VerifiedCert failed")
+			} else {
+				record("VerifiedCert")
+			}
+		},
+		WroteRequest:         func(err error) { record("WroteRequest") },
+		GotFirstResponseByte: func() { record("GotFirstResponseByte") },
+	}
+	return trace, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), events...)
+	}
+}
+
+func TestClientTrace(t *testing.T) {
+	addr := newSuccessServer(t)
+	_, port, _ := net.SplitHostPort(addr)
+
+	trace, events := recordTrace()
+	ctx := WithClientTrace(context.Background(), trace)
+	if ContextClientTrace(ctx) != trace {
+		t.Fatal("trace not found in context")
+	}
+
+	res, err := (&Client{}).FetchContext(ctx, "gemini://localhost:"+port+"/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res.Body.Close()
+
+	// localhost can resolve to more than one address, so only check the first
+	// connection attempt
+	got := events()
+	expected := []string{
+		"DNSStart", "DNSDone", "ConnectStart", "ConnectDone",
+		"TLSHandshakeStart", "TLSHandshakeDone", "VerifiedCert",
+		"WroteRequest", "GotFirstResponseByte",
+	}
+	if len(got) < len(expected) || !reflect.DeepEqual(got[:4], expected[:4]) ||
+		!reflect.DeepEqual(got[len(got)-5:], expected[4:]) {
+		t.Errorf("unexpected events %v", got)
+	}
+}
+
+func TestClientTraceProxy(t *testing.T) {
+	addr := newSuccessServer(t)
+	trace, events := recordTrace()
+	client := &Client{
+		Proxy: func(dialer *net.Dialer, address string) (net.Conn, error) {
+			return dialer.Dial("tcp", address)
+		},
+		CertStore: certStoreFunc(func(host string, cert *x509.Certificate) error {
+			return errors.New("not trusted")
+		}),
+	}
+	if _, err := client.FetchContext(WithClientTrace(context.Background(), trace), "gemini://"+addr+"/"); err == nil {
+		t.Fatal("expected error")
+	}
+
+	expected := []string{
+		"ProxyDialStart", "ProxyDialDone", "TLSHandshakeStart", "TLSHandshakeDone", "VerifiedCert failed",
+	}
+	if got := events(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected events %v, got %v", expected, got)
+	}
+}
+
+type certStoreFunc func(host string, cert *x509.Certificate) error
+
+func (f certStoreFunc) Check(host string, cert *x509.Certificate) error {
+	return f(host, cert)
+}
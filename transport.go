@@ -0,0 +1,25 @@
+package gemini
+
+// RoundTripper makes a single Gemini request and returns its response,
+// without following redirects. See Client.Transport.
+//
+// RoundTrip should not modify the request. If it returns a nil error, the
+// response must have a non-nil Body, which the caller will close.
+type RoundTripper interface {
+	RoundTrip(req *Request) (*Response, error)
+}
+
+// RoundTripperFunc allows the use of an ordinary function as a RoundTripper.
+type RoundTripperFunc func(req *Request) (*Response, error)
+
+// RoundTrip calls f(req).
+func (f RoundTripperFunc) RoundTrip(req *Request) (*Response, error) {
+	return f(req)
+}
+
+// DefaultTransport returns the RoundTripper used when Transport is nil. It
+// makes requests over the network, using all the settings of the client, such
+// as the timeouts, cert checks and Proxy.
+func (c *Client) DefaultTransport() RoundTripper {
+	return RoundTripperFunc(c.fetch)
+}
@@ -0,0 +1,76 @@
+package gemini
+
+import (
+	"errors"
+	"io/ioutil"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestClientTransport(t *testing.T) {
+	fault := errors.New("injected fault")
+	client := &Client{Transport: RoundTripperFunc(func(req *Request) (*Response, error) {
+		if req.URL.Path == "/fail" {
+			return nil, fault
+		}
+		return &Response{
+			Status: StatusSuccess,
+			Meta:   "text/plain",
+			Body:   ioutil.NopCloser(strings.NewReader(req.URL.Path)),
+		}, nil
+	})}
+
+	res, err := client.Fetch("gemini://example.invalid/ok")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	if string(body) != "/ok" {
+		t.Errorf("unexpected body %q", body)
+	}
+
+	if _, err := client.Fetch("gemini://example.invalid/fail"); err != fault {
+		t.Errorf("expected injected fault, got %v", err)
+	}
+}
+
+func TestClientTransportRequestHost(t *testing.T) {
+	var hosts []string
+	client := &Client{Transport: RoundTripperFunc(func(req *Request) (*Response, error) {
+		hosts = append(hosts, req.Host)
+		return &Response{Status: StatusSuccess, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+	})}
+
+	client.Fetch("gemini://example.invalid/")
+	client.FetchWithCert("gemini://example.invalid/", nil, nil)
+	client.FetchWithHost("proxy.invalid", "gemini://example.invalid/")
+	expected := []string{"", "", "proxy.invalid"}
+	if strings.Join(hosts, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected request hosts %q, got %q", expected, hosts)
+	}
+}
+
+func TestClientTransportWrapsDefault(t *testing.T) {
+	addr := newRedirectServer(t, map[string]string{"/a": "/b"})
+
+	var count int32
+	client := &Client{Redirects: &RedirectPolicy{}}
+	next := client.DefaultTransport()
+	client.Transport = RoundTripperFunc(func(req *Request) (*Response, error) {
+		atomic.AddInt32(&count, 1)
+		return next.RoundTrip(req)
+	})
+
+	res, err := client.Fetch("gemini://" + addr + "/a")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res.Body.Close()
+	if res.Status != StatusSuccess {
+		t.Errorf("expected success, got %d", res.Status)
+	}
+	if count != 2 {
+		t.Errorf("expected transport to be used for 2 requests, got %d", count)
+	}
+}